@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/kaorimatz/resque_exporter/pkg/resqueexporter"
+)
+
+func main() {
+	resqueexporter.Main()
+}
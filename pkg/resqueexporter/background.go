@@ -0,0 +1,89 @@
+package resqueexporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapeInterval = Flags.Duration(
+		"scrape.interval",
+		0,
+		"Interval to scrape Redis at in the background, serving the metrics of the last scrape without waiting for Redis. 0 scrapes Redis on every scrape of the exporter.",
+	)
+)
+
+var (
+	lastScrapeTimestampDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "last_scrape_timestamp_seconds"),
+		"Time the metrics were scraped from Redis in the background, in seconds since the epoch.",
+		nil, nil,
+	)
+)
+
+// snapshot is the metrics of the last background scrape of the targets.
+type snapshot struct {
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+	time    time.Time
+}
+
+// get returns the metrics of the last background scrape and the time of the
+// scrape, or false if there has been no scrape yet.
+func (s *snapshot) get() ([]prometheus.Metric, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.metrics, s.time, s.metrics != nil
+}
+
+// set replaces the metrics with the ones of a background scrape.
+func (s *snapshot) set(metrics []prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics, s.time = metrics, time.Now()
+}
+
+// reset discards the metrics.
+func (s *snapshot) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.metrics = nil
+}
+
+// scrapeEvery scrapes the targets at the interval in the background until the
+// context is done. Each scrape is canceled if it takes longer than the
+// interval.
+func (r *reloader) scrapeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.scrapeBackground(ctx, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *reloader) scrapeBackground(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	metrics := collectMetrics(func(ch chan<- prometheus.Metric) {
+		r.collector.collect(ctx, ch)
+	})
+	r.snapshot.set(r.depths.observe(metrics, time.Now()))
+	r.collected()
+}
@@ -0,0 +1,126 @@
+package resqueexporter
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	redisReconnectBackoffMax = Flags.Duration(
+		"redis.reconnect-backoff-max",
+		time.Minute,
+		"Maximum time to wait before reconnecting to the Redis after losing the connection.",
+	)
+	redisReconnectBackoffMin = Flags.Duration(
+		"redis.reconnect-backoff-min",
+		time.Second,
+		"Minimum time to wait before reconnecting to the Redis after losing the connection.",
+	)
+)
+
+var (
+	redisReconnectBackoffDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis", "reconnect_backoff_seconds"),
+		"Time to wait before the next attempt to reconnect to the Redis.",
+		nil, nil,
+	)
+)
+
+// backoff keeps track of the exponential backoff between the attempts to
+// reconnect to Redis after losing the connection.
+type backoff struct {
+	min, max time.Duration
+
+	mu      sync.Mutex
+	current time.Duration
+	next    time.Time
+
+	attempts prometheus.Counter
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{
+		min: min,
+		max: max,
+		attempts: newCreatedCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "redis",
+			Name:      "reconnect_attempts_total",
+			Help:      "Total number of attempts to reconnect to the Redis.",
+		}),
+	}
+}
+
+// allow reports whether Redis may be accessed now. While reconnecting, each
+// allowed access is counted as an attempt to reconnect.
+func (b *backoff) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == 0 {
+		return true
+	}
+	if time.Now().Before(b.next) {
+		return false
+	}
+	b.attempts.Inc()
+	return true
+}
+
+// update updates the backoff with the result of an access to Redis. Only
+// connection errors make the backoff grow; other errors leave it untouched.
+func (b *backoff) update(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.current = 0
+		return
+	}
+	if !isConnectionError(err) {
+		return
+	}
+
+	if b.current == 0 {
+		b.current = b.min
+	} else if b.current *= 2; b.current > b.max {
+		b.current = b.max
+	}
+	// Wait for a random duration between half and all of the backoff so
+	// that exporters losing the same Redis don't reconnect in lockstep.
+	wait := b.current/2 + time.Duration(rand.Int63n(int64(b.current/2)+1))
+	b.next = time.Now().Add(wait)
+}
+
+// isConnectionError reports whether the error is caused by a failure of the
+// connection rather than by a command.
+func isConnectionError(err error) bool {
+	if e, ok := err.(*collectorError); ok {
+		err = e.err
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Describe implements prometheus.Collector.
+func (b *backoff) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisReconnectBackoffDesc
+	ch <- b.attempts.Desc()
+}
+
+// Collect implements prometheus.Collector.
+func (b *backoff) Collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	current := b.current
+	b.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(redisReconnectBackoffDesc, prometheus.GaugeValue, current.Seconds())
+	ch <- b.attempts
+}
@@ -0,0 +1,162 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	benchScrapes = Flags.Int(
+		"bench.scrapes",
+		20,
+		"Number of the scrapes of each target run by the bench subcommand.",
+	)
+)
+
+// benchPercentiles are the percentiles of the latencies of the scrapes
+// reported by the bench subcommand.
+var benchPercentiles = []float64{0.5, 0.9, 0.99}
+
+// benchResult is the aggregated traces of the scrapes of a target.
+type benchResult struct {
+	latencies     []time.Duration
+	failed        int
+	firstErr      error
+	phases        []string
+	phaseTimes    map[string]time.Duration
+	phaseCommands map[string]int
+}
+
+func newBenchResult() *benchResult {
+	return &benchResult{
+		phaseTimes:    make(map[string]time.Duration),
+		phaseCommands: make(map[string]int),
+	}
+}
+
+// add adds the latency and the trace of a scrape.
+func (b *benchResult) add(latency time.Duration, t *scrapeTrace, err error) {
+	b.latencies = append(b.latencies, latency)
+	if err != nil {
+		b.failed++
+		if b.firstErr == nil {
+			b.firstErr = err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, phase := range t.phases {
+		if _, ok := b.phaseTimes[phase]; !ok {
+			b.phases = append(b.phases, phase)
+		}
+		b.phaseTimes[phase] += t.phaseTimes[phase]
+		b.phaseCommands[phase] += t.phaseCommands[phase]
+	}
+}
+
+// percentile returns the latency at the percentile by the nearest-rank method.
+func (b *benchResult) percentile(p float64) time.Duration {
+	latencies := append([]time.Duration(nil), b.latencies...)
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	i := int(math.Ceil(p*float64(len(latencies)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return latencies[i]
+}
+
+// write writes the latency percentiles, and the average time spent in and the
+// average number of the Redis commands sent in each phase per scrape. A
+// pipeline counts as a single command.
+func (b *benchResult) write(w io.Writer, target string) error {
+	fmt.Fprintf(w, "Target %s: %d scrapes, %d failed\n", target, len(b.latencies), b.failed)
+	if b.firstErr != nil {
+		fmt.Fprintf(w, "First error: %s\n", b.firstErr)
+	}
+
+	fmt.Fprintf(w, "Latency: min=%s", b.percentile(0))
+	for _, p := range benchPercentiles {
+		fmt.Fprintf(w, " p%g=%s", p*100, b.percentile(p))
+	}
+	fmt.Fprintf(w, " max=%s\n", b.percentile(1))
+
+	n := time.Duration(len(b.latencies))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tAVG TIME\tAVG COMMANDS")
+	for _, phase := range b.phases {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\n", phase, b.phaseTimes[phase]/n, float64(b.phaseCommands[phase])/float64(n))
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+// bench runs the scrapes of the exporter one after another, tracing each of
+// them.
+func (e *Collector) bench(scrapes int) (*benchResult, error) {
+	client, _ := e.redisEndpoints.get()
+	if err := client.Ping().Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan prometheus.Metric)
+	defer close(ch)
+	go func() {
+		for range ch {
+		}
+	}()
+
+	b := newBenchResult()
+	for i := 0; i < scrapes; i++ {
+		t := newScrapeTrace()
+		traced := e.withClient(traceClient(client, t))
+		traced.trace = t
+
+		start := time.Now()
+		err := traced.scrape(ch)
+		b.add(time.Since(start), t, err)
+	}
+	return b, nil
+}
+
+// runBench runs --bench.scrapes scrapes of each of the targets configured by
+// the flags, and writes the results to the writer.
+func runBench(w io.Writer) error {
+	if *benchScrapes < 1 {
+		return fmt.Errorf("invalid number of scrapes: %d", *benchScrapes)
+	}
+
+	r, err := newReloader(explicitFlags())
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.exporters) == 0 {
+		return fmt.Errorf("no targets to benchmark")
+	}
+	for i, exporter := range r.exporters {
+		target := redactedURL(r.targets[i].URL).String()
+		b, err := exporter.bench(*benchScrapes)
+		if err != nil {
+			fmt.Fprintf(w, "Target %s: %s\n\n", target, err)
+			continue
+		}
+		if err := b.write(w, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
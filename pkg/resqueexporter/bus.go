@@ -0,0 +1,92 @@
+package resqueexporter
+
+import (
+	"strings"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	resqueBusIncomingQueues = Flags.String(
+		"resque-bus.incoming-queues",
+		"bus_incoming",
+		"Comma-separated list of queues resque-bus publishes events to.",
+	)
+)
+
+var (
+	busAppsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "apps"),
+		"Number of applications registered with resque-bus.",
+		nil, nil,
+	)
+	busIncomingJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "incoming_jobs"),
+		"Number of jobs in a resque-bus incoming queue.",
+		[]string{"queue"}, nil,
+	)
+	busSubscriptionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bus", "subscriptions"),
+		"Number of resque-bus subscriptions of an application.",
+		[]string{"app"}, nil,
+	)
+)
+
+func init() {
+	registerCollector("resque-bus", false, "Collect metrics of resque-bus applications, subscriptions and incoming queues.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeResqueBus(ch)
+	})
+}
+
+func (e *Collector) scrapeResqueBus(ch chan<- prometheus.Metric) error {
+	appsKey := e.redisKey("bus_apps")
+	apps, err := e.setMembers(appsKey)
+	if isWrongTypeError(err) {
+		e.skipKey(appsKey, skipWrongType, err)
+	} else if err != nil {
+		return err
+	} else {
+		ch <- prometheus.MustNewConstMetric(busAppsDesc, prometheus.GaugeValue, float64(len(apps)))
+	}
+
+	appKeys := make([]string, len(apps))
+	cmds := make([]*redis.IntCmd, len(apps))
+	err = e.pipelined(len(apps), func(pipe redis.Pipeliner, i int) {
+		appKeys[i] = e.redisKey("bus_app", apps[i])
+		cmds[i] = pipe.HLen(appKeys[i])
+	})
+	if err != nil {
+		return err
+	}
+	for i, cmd := range cmds {
+		subscriptions, err := cmd.Result()
+		if isWrongTypeError(err) {
+			e.skipKey(appKeys[i], skipWrongType, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(busSubscriptionsDesc, prometheus.GaugeValue, float64(subscriptions), apps[i])
+	}
+
+	var queues, queueKeys []string
+	for _, queue := range strings.Split(*resqueBusIncomingQueues, ",") {
+		if queue != "" {
+			queues = append(queues, queue)
+			queueKeys = append(queueKeys, e.redisKey("queue", queue))
+		}
+	}
+	queueJobs, err := e.listLengths(queueKeys)
+	if err != nil {
+		return err
+	}
+	for i, queue := range queues {
+		if queueJobs[i] < 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(busIncomingJobsDesc, prometheus.GaugeValue, float64(queueJobs[i]), queue)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package resqueexporter
+
+import (
+	"testing"
+)
+
+func TestCollectorResqueBus(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:bus_apps", "a", "b", "c")
+	r.hset("resque:bus_app:a", "event_1", "{}")
+	r.hset("resque:bus_app:a", "event_2", "{}")
+	r.hset("resque:bus_app:b", "event_1", "{}")
+	r.set("resque:bus_app:c", "not a hash")
+	r.rpush("resque:queue:bus_incoming", "{}", "{}", "{}")
+	setFlags(t, map[string]string{"collector.resque-bus": "true"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "resque-bus"}, 1)
+	assertSample(t, mfs, "resque_bus_apps", nil, 3)
+	assertSample(t, mfs, "resque_bus_subscriptions", map[string]string{"app": "a"}, 2)
+	assertSample(t, mfs, "resque_bus_subscriptions", map[string]string{"app": "b"}, 1)
+	assertNoSample(t, mfs, "resque_bus_subscriptions", map[string]string{"app": "c"})
+	assertSample(t, mfs, "resque_bus_incoming_jobs", map[string]string{"queue": "bus_incoming"}, 3)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "wrong_type"}, 1)
+	for _, command := range r.received() {
+		if command == "smembers" {
+			t.Error("the apps are read with SMEMBERS")
+		}
+	}
+}
+
+func TestCollectorResqueBusWrongTypeApps(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("resque:bus_apps", "not a set")
+	setFlags(t, map[string]string{"collector.resque-bus": "true"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "resque-bus"}, 1)
+	assertNoSample(t, mfs, "resque_bus_apps", nil)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "wrong_type"}, 1)
+}
@@ -0,0 +1,142 @@
+package resqueexporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapeCacheTTL = Flags.Duration(
+		"scrape.cache-ttl",
+		0,
+		"Duration for which the metrics of a scrape of Redis are reused by the following scrapes, e.g. of Prometheus servers in HA pairs. 0 disables the cache.",
+	)
+)
+
+// scrapeCache keeps the metrics of the last scrape of the targets for the
+// duration given by --scrape.cache-ttl.
+type scrapeCache struct {
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+	expires time.Time
+}
+
+// get returns the metrics of the last scrape, or false if they are expired.
+func (c *scrapeCache) get() ([]prometheus.Metric, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metrics == nil || time.Now().After(c.expires) {
+		return nil, false
+	}
+	return c.metrics, true
+}
+
+// set keeps the metrics of a scrape.
+func (c *scrapeCache) set(metrics []prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics, c.expires = metrics, time.Now().Add(*scrapeCacheTTL)
+}
+
+// reset discards the metrics kept.
+func (c *scrapeCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = nil
+}
+
+// scrapeGroup coalesces concurrent scrapes of the targets. A scrape requested
+// while another one is in flight waits for it and shares its metrics, instead
+// of scraping Redis again.
+type scrapeGroup struct {
+	mu   sync.Mutex
+	call *scrapeCall
+}
+
+type scrapeCall struct {
+	done    chan struct{}
+	metrics []prometheus.Metric
+	// waiters is the number of the callers waiting for the scrape. The
+	// scrape is canceled when all of them are gone.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do returns the metrics returned by scrape, or the ones of the scrape in
+// flight if any. The scrape runs with a context detached from the ones of the
+// callers, bounded by the deadline of the first of them, so that a caller
+// going away doesn't cancel the scrape shared by the others. Each caller waits
+// until its own context is done, returning its error, and the scrape is
+// canceled when the last caller waiting for it is gone.
+func (g *scrapeGroup) do(ctx context.Context, scrape func(ctx context.Context) []prometheus.Metric) ([]prometheus.Metric, error) {
+	g.mu.Lock()
+	c := g.call
+	if c == nil {
+		c = &scrapeCall{done: make(chan struct{})}
+
+		var scrapeCtx context.Context
+		if deadline, ok := ctx.Deadline(); ok {
+			scrapeCtx, c.cancel = context.WithDeadline(context.Background(), deadline)
+		} else {
+			scrapeCtx, c.cancel = context.WithCancel(context.Background())
+		}
+		g.call = c
+		go func() {
+			defer c.cancel()
+			c.metrics = scrape(scrapeCtx)
+
+			g.mu.Lock()
+			if g.call == c {
+				g.call = nil
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.metrics, nil
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		// The scrape canceled isn't shared by the callers coming
+		// next, which start a new one.
+		c.cancel()
+		if g.call == c {
+			g.call = nil
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// collectMetrics returns the metrics sent to the channel by collect.
+func collectMetrics(collect func(ch chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	metrics := []prometheus.Metric{}
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+
+	collect(ch)
+	close(ch)
+	<-done
+
+	return metrics
+}
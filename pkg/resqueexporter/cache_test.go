@@ -0,0 +1,137 @@
+package resqueexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeGroupSharesScrape(t *testing.T) {
+	var g scrapeGroup
+	started := make(chan struct{})
+	release := make(chan struct{})
+	metric := prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+
+	// The scrape outlives the canceled context of the caller starting it
+	// while another caller waits for it.
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	scrapeErr := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, func(ctx context.Context) []prometheus.Metric {
+			close(started)
+			<-release
+			scrapeErr <- ctx.Err()
+			return []prometheus.Metric{metric}
+		})
+		firstErr <- err
+	}()
+	<-started
+	result := make(chan []prometheus.Metric)
+	go func() {
+		metrics, _ := g.do(context.Background(), func(context.Context) []prometheus.Metric {
+			t.Error("scraped again")
+			return nil
+		})
+		result <- metrics
+	}()
+	waitForWaiters(t, &g, 2)
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	// A waiter returns when its own context is done.
+	waiterCtx, waiterCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waiterCancel()
+	if _, err := g.do(waiterCtx, nil); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The other waiters share the metrics of the scrape.
+	close(release)
+	if metrics := <-result; len(metrics) != 1 || metrics[0] != metric {
+		t.Errorf("got %v, want the metrics of the shared scrape", metrics)
+	}
+	if err := <-scrapeErr; err != nil {
+		t.Errorf("scrape context: %s", err)
+	}
+}
+
+func TestScrapeGroupCancelsScrape(t *testing.T) {
+	r := newFakeRedis(t)
+	client, err := newRedisClient(r.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var g scrapeGroup
+	started := make(chan struct{})
+	scrapeErr := make(chan error, 1)
+	scrape := func(ctx context.Context) []prometheus.Metric {
+		client := contextClient(ctx, client)
+		close(started)
+		for ctx.Err() == nil {
+			client.Ping()
+		}
+		scrapeErr <- ctx.Err()
+		return nil
+	}
+
+	// All the callers go away before the scrape finishes.
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.do(ctx1, scrape)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.do(ctx2, scrape)
+		errs <- err
+	}()
+	waitForWaiters(t, &g, 2)
+	cancel1()
+	cancel2()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.Canceled {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	}
+
+	select {
+	case err := <-scrapeErr:
+		if err != context.Canceled {
+			t.Errorf("scrape stopped with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the scrape kept running after all the callers were gone")
+	}
+	n := len(r.received())
+	time.Sleep(10 * time.Millisecond)
+	if got := len(r.received()); got != n {
+		t.Errorf("%d commands received after the scrape stopped", got-n)
+	}
+}
+
+// waitForWaiters waits until n callers wait for the scrape in flight.
+func waitForWaiters(t *testing.T, g *scrapeGroup, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		waiters := 0
+		if g.call != nil {
+			waiters = g.call.waiters
+		}
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %d waiters", n)
+}
@@ -0,0 +1,237 @@
+package resqueexporter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	scrapeLabelLimit = Flags.Int(
+		"scrape.label-limit",
+		0,
+		"Maximum number of values of the queue and class labels of each metric in a scrape. The series of the other values are summed into the series labeled _other. 0 disables the limit.",
+	)
+)
+
+// limitedLabels are the labels whose values are limited by
+// --scrape.label-limit.
+var limitedLabels = map[string]bool{
+	"class": true,
+	"queue": true,
+}
+
+// otherLabelValue is the value of the limited label of the series summing the
+// series over the limit.
+const otherLabelValue = "_other"
+
+// labeledSeries is a series of a metric having one of the given labels.
+type labeledSeries struct {
+	metric prometheus.Metric
+	dto    *dto.Metric
+	label  int
+}
+
+// newLabeledSeries returns the series of the metric, or nil if the metric
+// doesn't have any of the labels.
+func newLabeledSeries(m prometheus.Metric, labels map[string]bool) *labeledSeries {
+	s := &labeledSeries{metric: m, dto: &dto.Metric{}}
+	if err := m.Write(s.dto); err != nil {
+		return nil
+	}
+	for i, l := range s.dto.Label {
+		if labels[l.GetName()] {
+			s.label = i
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *labeledSeries) value() string {
+	return s.dto.Label[s.label].GetValue()
+}
+
+// otherKey returns the labels of the series other than the given one.
+func (s *labeledSeries) otherKey() string {
+	pairs := make([]string, 0, len(s.dto.Label))
+	for i, l := range s.dto.Label {
+		if i != s.label {
+			pairs = append(pairs, l.GetName()+"="+l.GetValue())
+		}
+	}
+	return strings.Join(pairs, "\xff")
+}
+
+// summedMetric is a metric summing series.
+type summedMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+// Desc implements prometheus.Metric.
+func (m *summedMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements prometheus.Metric.
+func (m *summedMetric) Write(out *dto.Metric) error {
+	proto.Merge(out, m.metric)
+	return nil
+}
+
+// add adds the value of the series to the metric. The quantiles of summaries
+// can't be summed, so the summed summaries only have their counts and sums.
+func (m *summedMetric) add(s *labeledSeries) {
+	switch {
+	case m.metric.Summary != nil:
+		m.metric.Summary.SampleCount = proto.Uint64(m.metric.Summary.GetSampleCount() + s.dto.Summary.GetSampleCount())
+		m.metric.Summary.SampleSum = proto.Float64(m.metric.Summary.GetSampleSum() + s.dto.Summary.GetSampleSum())
+	case m.metric.Histogram != nil:
+		h := m.metric.Histogram
+		h.SampleCount = proto.Uint64(h.GetSampleCount() + s.dto.Histogram.GetSampleCount())
+		h.SampleSum = proto.Float64(h.GetSampleSum() + s.dto.Histogram.GetSampleSum())
+	buckets:
+		for _, b := range s.dto.Histogram.Bucket {
+			for _, sum := range h.Bucket {
+				if sum.GetUpperBound() == b.GetUpperBound() {
+					sum.CumulativeCount = proto.Uint64(sum.GetCumulativeCount() + b.GetCumulativeCount())
+					continue buckets
+				}
+			}
+			h.Bucket = append(h.Bucket, &dto.Bucket{
+				UpperBound:      proto.Float64(b.GetUpperBound()),
+				CumulativeCount: proto.Uint64(b.GetCumulativeCount()),
+			})
+		}
+		sort.Slice(h.Bucket, func(i, j int) bool {
+			return h.Bucket[i].GetUpperBound() < h.Bucket[j].GetUpperBound()
+		})
+	case m.metric.Gauge != nil:
+		m.metric.Gauge.Value = proto.Float64(m.metric.Gauge.GetValue() + s.dto.Gauge.GetValue())
+	case m.metric.Counter != nil:
+		m.metric.Counter.Value = proto.Float64(m.metric.Counter.GetValue() + s.dto.Counter.GetValue())
+	case m.metric.Untyped != nil:
+		m.metric.Untyped.Value = proto.Float64(m.metric.Untyped.GetValue() + s.dto.Untyped.GetValue())
+	}
+}
+
+// newSummedMetric returns a metric with the labels of the series, but the value
+// of its label, and the value of zero.
+func newSummedMetric(s *labeledSeries, value string) *summedMetric {
+	m := &dto.Metric{
+		Label: make([]*dto.LabelPair, len(s.dto.Label)),
+	}
+	copy(m.Label, s.dto.Label)
+	m.Label[s.label] = &dto.LabelPair{
+		Name:  proto.String(s.dto.Label[s.label].GetName()),
+		Value: proto.String(value),
+	}
+	switch {
+	case s.dto.Gauge != nil:
+		m.Gauge = &dto.Gauge{Value: proto.Float64(0)}
+	case s.dto.Counter != nil:
+		m.Counter = &dto.Counter{Value: proto.Float64(0)}
+	case s.dto.Untyped != nil:
+		m.Untyped = &dto.Untyped{Value: proto.Float64(0)}
+	case s.dto.Summary != nil:
+		m.Summary = &dto.Summary{SampleCount: proto.Uint64(0), SampleSum: proto.Float64(0)}
+	case s.dto.Histogram != nil:
+		m.Histogram = &dto.Histogram{SampleCount: proto.Uint64(0), SampleSum: proto.Float64(0)}
+	}
+	return &summedMetric{desc: s.metric.Desc(), metric: m}
+}
+
+// limitSeries returns the series with up to limit values of the limited label,
+// keeping the lowest values in lexical order so that the same ones are kept in
+// every scrape, and the series summing the others. The number of the series
+// summed is also returned.
+func limitSeries(series []*labeledSeries, limit int) ([]prometheus.Metric, int) {
+	seen := make(map[string]bool)
+	var values []string
+	for _, s := range series {
+		if v := s.value(); !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+
+	metrics := make([]prometheus.Metric, 0, len(series))
+	if len(values) <= limit {
+		for _, s := range series {
+			metrics = append(metrics, s.metric)
+		}
+		return metrics, 0
+	}
+
+	sort.Strings(values)
+	kept := make(map[string]bool, limit)
+	for _, v := range values[:limit] {
+		kept[v] = true
+	}
+
+	var truncated int
+	others := make(map[string]*summedMetric)
+	for _, s := range series {
+		if kept[s.value()] {
+			metrics = append(metrics, s.metric)
+			continue
+		}
+		key := s.otherKey()
+		other, ok := others[key]
+		if !ok {
+			other = newSummedMetric(s, otherLabelValue)
+			others[key] = other
+			metrics = append(metrics, other)
+		}
+		other.add(s)
+		truncated++
+	}
+
+	return metrics, truncated
+}
+
+// limitLabels returns a channel forwarding the metrics sent to it to ch, with
+// up to limit values of the limited labels of each metric. The metrics having
+// the limited labels are forwarded once all the metrics are sent. The returned
+// function must be called once all the metrics are sent, and returns the
+// number of the series summed after they are forwarded.
+func limitLabels(ch chan<- prometheus.Metric, limit int) (chan<- prometheus.Metric, func() int) {
+	limitedCh := make(chan prometheus.Metric)
+	truncatedCh := make(chan int)
+	go func() {
+		var descs []string
+		families := make(map[string][]*labeledSeries)
+		for m := range limitedCh {
+			s := newLabeledSeries(m, limitedLabels)
+			if s == nil {
+				ch <- m
+				continue
+			}
+
+			desc := m.Desc().String()
+			if _, ok := families[desc]; !ok {
+				descs = append(descs, desc)
+			}
+			families[desc] = append(families[desc], s)
+		}
+
+		var truncated int
+		for _, desc := range descs {
+			metrics, n := limitSeries(families[desc], limit)
+			for _, m := range metrics {
+				ch <- m
+			}
+			truncated += n
+		}
+		truncatedCh <- truncated
+	}()
+
+	return limitedCh, func() int {
+		close(limitedCh)
+		return <-truncatedCh
+	}
+}
@@ -0,0 +1,76 @@
+package resqueexporter
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	checkConfig = Flags.Bool(
+		"check-config",
+		false,
+		"Validate the configuration and the flags, then exit.",
+	)
+	checkConfigConnect = Flags.Bool(
+		"check-config.connect",
+		false,
+		"With --check-config, also connect to the Redis and verify the namespaces contain Resque keys.",
+	)
+)
+
+// check connects to the Redis and verifies that each of the namespaces the
+// exporter collects metrics from contains the keys of Resque.
+func (e *Collector) check() error {
+	if err := e.redisClient.Ping().Err(); err != nil {
+		return err
+	}
+
+	namespaces := e.redisNamespaces
+	if *discoverNamespaces {
+		var err error
+		if namespaces, err = e.namespaces(); err != nil {
+			return err
+		}
+		if len(namespaces) == 0 {
+			return fmt.Errorf("no namespaces found")
+		}
+	} else if namespaces == nil {
+		namespaces = []string{e.redisNamespace}
+	}
+
+	for _, ns := range namespaces {
+		c := e.withNamespace(ns)
+		// The keys are checked one by one, as a multi-key EXISTS fails
+		// with CROSSSLOT on Redis Cluster.
+		keys := []string{c.redisKey("queues"), c.redisKey("workers"), c.redisKey("stat", "processed")}
+		cmds := make([]*redis.IntCmd, len(keys))
+		if err := c.pipelined(len(keys), func(pipe redis.Pipeliner, i int) {
+			cmds[i] = pipe.Exists(keys[i])
+		}); err != nil {
+			return err
+		}
+		var n int64
+		for _, cmd := range cmds {
+			n += cmd.Val()
+		}
+		if n == 0 {
+			return fmt.Errorf("no Resque keys found in namespace %s", ns)
+		}
+	}
+
+	return nil
+}
+
+// check connects to the Redis of each target and verifies its namespaces.
+func (r *reloader) check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i, exporter := range r.exporters {
+		if err := exporter.check(); err != nil {
+			return fmt.Errorf("%s: %s", redactedURL(r.targets[i].URL), err)
+		}
+	}
+	return nil
+}
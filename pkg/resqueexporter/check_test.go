@@ -0,0 +1,35 @@
+package resqueexporter
+
+import (
+	"testing"
+)
+
+func TestCollectorCheck(t *testing.T) {
+	r := newFakeRedis(t)
+	r.set("resque:stat:processed", "1")
+
+	if err := newTestCollector(t, r).check(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are checked by single-key EXISTS commands, which work on
+	// Redis Cluster.
+	var exists int
+	for _, name := range r.received() {
+		if name == "exists" {
+			exists++
+		}
+	}
+	if exists != 3 {
+		t.Errorf("got %d EXISTS commands, want 3", exists)
+	}
+}
+
+func TestCollectorCheckNoKeys(t *testing.T) {
+	r := newFakeRedis(t)
+	r.set("other:stat:processed", "1")
+
+	if err := newTestCollector(t, r).check(); err == nil {
+		t.Error("expected an error for a namespace without Resque keys")
+	}
+}
@@ -0,0 +1,291 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	cloudWatchNamespace = Flags.String(
+		"cloudwatch.namespace",
+		"",
+		"Namespace of the CloudWatch metrics to publish the metrics to at the interval, in addition to serving them over HTTP.",
+	)
+	cloudWatchRegion = Flags.String(
+		"cloudwatch.region",
+		"",
+		"AWS region of CloudWatch to publish the metrics to. Defaults to the AWS_REGION environment variable.",
+	)
+	cloudWatchEndpoint = Flags.String(
+		"cloudwatch.endpoint",
+		"",
+		"URL of the CloudWatch API, instead of the one of the region.",
+	)
+	cloudWatchInterval = Flags.Duration(
+		"cloudwatch.interval",
+		time.Minute,
+		"Interval to publish the metrics to CloudWatch at.",
+	)
+	cloudWatchMetrics = newStringsValue(
+		"resque_failed_job_executions_total",
+		"resque_jobs_in_failed_queue",
+		"resque_jobs_in_queue",
+		"resque_jobs_pending_total",
+		"resque_up",
+		"resque_workers",
+		"resque_working_workers",
+	)
+	cloudWatchDimensions = newStringsValue()
+)
+
+func init() {
+	Flags.Var(cloudWatchMetrics, "cloudwatch.metric", "Name of the metric to publish to CloudWatch. Can be repeated.")
+	Flags.Var(cloudWatchDimensions, "cloudwatch.dimension", "Dimension in the form of name=value to add to the metrics published to CloudWatch. Can be repeated.")
+}
+
+const (
+	// cloudWatchMaxDatums is the maximum number of the metric data in a
+	// PutMetricData request.
+	cloudWatchMaxDatums = 1000
+	// cloudWatchMaxDimensions is the maximum number of the dimensions of a
+	// metric datum.
+	cloudWatchMaxDimensions = 30
+)
+
+// cloudWatchSink publishes the metrics to CloudWatch with the PutMetricData
+// API. The labels of the metrics are published as the dimensions, and the
+// values of the counters as they are. The credentials are read from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables.
+type cloudWatchSink struct {
+	namespace  string
+	region     string
+	url        string
+	client     *http.Client
+	metrics    map[string]bool
+	dimensions []labelPair
+}
+
+// newCloudWatchSink returns a CloudWatch sink configured by the flags.
+func newCloudWatchSink() (*cloudWatchSink, error) {
+	region := *cloudWatchRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("--cloudwatch.region or AWS_REGION is required to publish the metrics to CloudWatch")
+	}
+	s := &cloudWatchSink{
+		namespace: *cloudWatchNamespace,
+		region:    region,
+		url:       *cloudWatchEndpoint,
+		client:    &http.Client{Timeout: *cloudWatchInterval},
+		metrics:   make(map[string]bool),
+	}
+	if s.url == "" {
+		s.url = "https://monitoring." + s.region + ".amazonaws.com/"
+	}
+	for _, name := range cloudWatchMetrics.values {
+		s.metrics[name] = true
+	}
+	for _, dimension := range cloudWatchDimensions.values {
+		parts := strings.SplitN(dimension, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid dimension: %s", dimension)
+		}
+		s.dimensions = append(s.dimensions, labelPair{parts[0], parts[1]})
+	}
+	return s, nil
+}
+
+// String implements sink.
+func (s *cloudWatchSink) String() string {
+	return "CloudWatch namespace " + s.namespace + " in " + s.region
+}
+
+// push implements sink.
+func (s *cloudWatchSink) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var selected []*dto.MetricFamily
+	for _, mf := range mfs {
+		if s.metrics[mf.GetName()] {
+			selected = append(selected, mf)
+		}
+	}
+
+	form := url.Values{}
+	n := 0
+	for _, sample := range samples(selected, time.Now()) {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			// CloudWatch rejects them.
+			continue
+		}
+		if n == cloudWatchMaxDatums {
+			if err := s.putMetricData(ctx, form); err != nil {
+				return err
+			}
+			form, n = url.Values{}, 0
+		}
+		n++
+		s.addDatum(form, n, sample)
+	}
+	if n == 0 {
+		return nil
+	}
+	return s.putMetricData(ctx, form)
+}
+
+// addDatum adds the sample to the form as the n-th metric datum.
+func (s *cloudWatchSink) addDatum(form url.Values, n int, sample sample) {
+	prefix := "MetricData.member." + strconv.Itoa(n) + "."
+	form.Set(prefix+"MetricName", sample.name)
+	form.Set(prefix+"Value", strconv.FormatFloat(sample.value, 'g', -1, 64))
+	form.Set(prefix+"Timestamp", time.Unix(0, sample.timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339))
+
+	// The labels of the metrics take precedence over the dimensions given by
+	// the flags, and the empty values, which CloudWatch rejects, are omitted.
+	var dimensions []labelPair
+	for _, l := range sortLabels(append(append([]labelPair(nil), sample.labels...), s.dimensions...)) {
+		if l.value != "" && len(dimensions) < cloudWatchMaxDimensions {
+			dimensions = append(dimensions, l)
+		}
+	}
+	for i, d := range dimensions {
+		dimension := prefix + "Dimensions.member." + strconv.Itoa(i+1) + "."
+		form.Set(dimension+"Name", d.name)
+		form.Set(dimension+"Value", d.value)
+	}
+}
+
+func (s *cloudWatchSink) putMetricData(ctx context.Context, form url.Values) error {
+	form.Set("Action", "PutMetricData")
+	form.Set("Version", "2010-08-01")
+	form.Set("Namespace", s.namespace)
+	body := []byte(form.Encode())
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("User-Agent", "resque_exporter/"+version.Version)
+	if err := signAWSRequest(req, body, s.region, "monitoring", time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// signAWSRequest signs the request with the Signature Version 4 of AWS, using
+// the credentials in the environment variables.
+func signAWSRequest(req *http.Request, body []byte, region, service string, now time.Time) error {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to sign the requests to AWS")
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := []labelPair{
+		{"content-type", req.Header.Get("Content-Type")},
+		{"host", req.URL.Host},
+		{"x-amz-date", amzDate},
+	}
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		headers = append(headers, labelPair{"x-amz-security-token", token})
+	}
+	var canonicalHeaders, signedHeaders []string
+	for _, h := range headers {
+		canonicalHeaders = append(canonicalHeaders, h.name+":"+strings.TrimSpace(h.value)+"\n")
+		signedHeaders = append(signedHeaders, h.name)
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		strings.Join(canonicalHeaders, ""),
+		strings.Join(signedHeaders, ";"),
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+	return nil
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// startCloudWatch starts publishing the metrics of the targets to the
+// CloudWatch namespace given by --cloudwatch.namespace until the context is
+// done.
+func startCloudWatch(ctx context.Context, r *reloader) error {
+	s, err := newCloudWatchSink()
+	if err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, s, *cloudWatchInterval)
+	return nil
+}
@@ -0,0 +1,83 @@
+package resqueexporter
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeState holds what the collectors of a scrape of a namespace share with
+// the collectors run after them.
+type scrapeState struct {
+	filter *queueFilter
+
+	// queues are all the queues, set by the queues collector.
+	queues    []string
+	queuesErr error
+
+	// workers are the live workers, set by the workers collector.
+	workers    []string
+	workersErr error
+}
+
+func newScrapeState(filter *queueFilter) *scrapeState {
+	return &scrapeState{
+		filter:     filter,
+		queuesErr:  errQueuesNotCollected,
+		workersErr: errWorkersNotCollected,
+	}
+}
+
+// scrapeFunc scrapes the metrics of a collector of the namespace of the
+// exporter.
+type scrapeFunc func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error
+
+// subCollector is a collector of a part of the metrics of a namespace.
+type subCollector struct {
+	name    string
+	enabled func() bool
+	scrape  scrapeFunc
+
+	// core is true for the collectors whose results the other
+	// collectors depend on, which are run first.
+	core bool
+}
+
+var subCollectors []subCollector
+
+// registerCollector registers a collector enabled by the
+// --collector.<name> flag.
+func registerCollector(name string, enabled bool, help string, scrape scrapeFunc) {
+	value := Flags.Bool("collector."+name, enabled, help)
+	subCollectors = append(subCollectors, subCollector{
+		name:    name,
+		enabled: func() bool { return *value },
+		scrape:  scrape,
+	})
+}
+
+// registerCoreCollector registers a collector like registerCollector,
+// running it before the collectors that are not core.
+func registerCoreCollector(name string, enabled bool, help string, scrape scrapeFunc) {
+	registerCollector(name, enabled, help, scrape)
+	subCollectors[len(subCollectors)-1].core = true
+}
+
+// enabledCollectors returns the enabled collectors in the order to run them:
+// the core collectors in the order registered, followed by the others sorted
+// by name.
+func enabledCollectors() []subCollector {
+	var collectors []subCollector
+	for _, c := range subCollectors {
+		if c.enabled() {
+			collectors = append(collectors, c)
+		}
+	}
+	sort.SliceStable(collectors, func(i, j int) bool {
+		if collectors[i].core != collectors[j].core {
+			return collectors[i].core
+		}
+		return !collectors[i].core && collectors[i].name < collectors[j].name
+	})
+	return collectors
+}
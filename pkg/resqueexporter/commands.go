@@ -0,0 +1,64 @@
+package resqueexporter
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	redisCommands = newCreatedCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "resque_exporter",
+			Subsystem: "redis",
+			Name:      "commands_total",
+			Help:      "Total number of Redis commands issued by the exporter, including the ones in pipelines.",
+		},
+		[]string{"command"},
+	)
+	redisCommandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "resque_exporter",
+			Subsystem: "redis",
+			Name:      "command_duration_seconds",
+			Help:      "Time the round trips of the Redis commands issued by the exporter took. A pipeline is observed as a single command named pipeline.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"command"},
+	)
+)
+
+// instrumentClient makes the client count the commands and observe the time
+// they take.
+func instrumentClient(client redis.UniversalClient) {
+	wrapProcess := func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			redisCommands.WithLabelValues(cmd.Name()).Inc()
+			redisCommandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+	wrapProcessPipeline := func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			for _, cmd := range cmds {
+				redisCommands.WithLabelValues(cmd.Name()).Inc()
+			}
+			redisCommandDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+
+	switch c := client.(type) {
+	case *redis.Client:
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+	case *redis.ClusterClient:
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+	}
+}
@@ -0,0 +1,152 @@
+package resqueexporter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	resqueCompat = Flags.String(
+		"resque.compat",
+		"",
+		"Comma-separated list of other Resque implementations sharing the Redis: node to exclude the workers whose pings expired from the live workers, php to report missing stat counters as 0.",
+	)
+)
+
+var (
+	delayedJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "delayed_jobs"),
+		"Number of delayed jobs.",
+		nil, nil,
+	)
+)
+
+func init() {
+	registerCollector("node-delayed-jobs", false, "Collect the number of jobs delayed by node-resque.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeNodeDelayedJobs(ch)
+	})
+}
+
+// compatEnabled reports whether the compatibility with the given Resque
+// implementation is enabled.
+func compatEnabled(implementation string) bool {
+	for _, c := range strings.Split(*resqueCompat, ",") {
+		if strings.TrimSpace(c) == implementation {
+			return true
+		}
+	}
+	return false
+}
+
+// stats returns the values of the stat counters by name, getting them in a
+// single round trip. The counters that are not numbers are skipped.
+func (e *Collector) stats(names ...string) (map[string]float64, error) {
+	cmds := make([]*redis.StringCmd, len(names))
+	err := e.pipelined(len(names), func(pipe redis.Pipeliner, i int) {
+		cmds[i] = pipe.Get(e.redisKey("stat", names[i]))
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64, len(names))
+	for i, cmd := range cmds {
+		value, err := cmd.Result()
+		// php-resque creates the stat counters lazily when the first
+		// job is processed or failed, and deletes them along with the
+		// worker stats when the worker that created them shuts down.
+		if err == redis.Nil && compatEnabled("php") {
+			values[names[i]] = 0
+			continue
+		}
+		if isWrongTypeError(err) {
+			e.skipKey(e.redisKey("stat", names[i]), skipWrongType, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.skipKey(e.redisKey("stat", names[i]), skipInvalidValue, err)
+			continue
+		}
+		values[names[i]] = f
+	}
+	return values, nil
+}
+
+// expiredPings adds the node-resque workers whose last ping is older than the
+// prune interval to dead. node-resque workers ping worker:ping:<name>, where
+// the name is the worker ID without its queues, with the time in seconds.
+func (e *Collector) expiredPings(now time.Time, workers []string, dead map[string]bool) error {
+	keys := make([]string, len(workers))
+	cmds := make([]*redis.StringCmd, len(workers))
+	err := e.pipelined(len(workers), func(pipe redis.Pipeliner, i int) {
+		if j := strings.LastIndex(workers[i], ":"); j >= 0 {
+			keys[i] = e.redisKey("worker", "ping", workers[i][:j])
+			cmds[i] = pipe.Get(keys[i])
+		}
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		ping, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		seconds, err := strconv.ParseInt(ping, 10, 64)
+		if err != nil {
+			e.skipKey(keys[i], skipInvalidValue, err)
+			continue
+		}
+		if now.Sub(time.Unix(seconds, 0)) > pruneInterval {
+			dead[workers[i]] = true
+		}
+	}
+	return nil
+}
+
+// scrapeNodeDelayedJobs exports the number of jobs node-resque delayed. The
+// timestamps at which jobs are scheduled are kept in the
+// delayed_queue_schedule sorted set, and the jobs in delayed:<timestamp>.
+func (e *Collector) scrapeNodeDelayedJobs(ch chan<- prometheus.Metric) error {
+	scheduleKey := e.redisKey("delayed_queue_schedule")
+	timestamps, err := e.redisClient.ZRange(scheduleKey, 0, -1).Result()
+	if isWrongTypeError(err) {
+		e.skipKey(scheduleKey, skipWrongType, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keys := make([]string, len(timestamps))
+	for i, timestamp := range timestamps {
+		keys[i] = e.redisKey("delayed", timestamp)
+	}
+	lengths, err := e.listLengths(keys)
+	if err != nil {
+		return err
+	}
+
+	var delayedJobs int64
+	for _, jobs := range lengths {
+		if jobs > 0 {
+			delayedJobs += jobs
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(delayedJobsDesc, prometheus.GaugeValue, float64(delayedJobs))
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package resqueexporter
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = Flags.String(
+		"config.file",
+		"",
+		"Path to the YAML configuration file. Flags given on the command line take precedence over it.",
+	)
+)
+
+// config is the configuration read from the file given by --config.file.
+type config struct {
+	Targets    []targetConfig  `yaml:"targets"`
+	Collectors map[string]bool `yaml:"collectors"`
+	Queues     queuesConfig    `yaml:"queues"`
+	Web        webConfig       `yaml:"web"`
+}
+
+// targetConfig describes a Redis to collect metrics from.
+type targetConfig struct {
+	URL       string            `yaml:"url"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+// queuesConfig describes the queues to collect metrics of.
+type queuesConfig struct {
+	Include string          `yaml:"include,omitempty"`
+	Exclude string          `yaml:"exclude,omitempty"`
+	Static  []string        `yaml:"static,omitempty"`
+	Rewrite []rewriteConfig `yaml:"rewrite,omitempty"`
+}
+
+type webConfig struct {
+	ListenAddress string `yaml:"listen_address"`
+	TelemetryPath string `yaml:"telemetry_path"`
+}
+
+// loadConfig reads and validates the configuration file.
+func loadConfig(filename string) (*config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %s", filename, err)
+	}
+
+	for i, target := range c.Targets {
+		if target.URL == "" {
+			return nil, fmt.Errorf("no URL for target %d", i)
+		}
+		for name := range target.Labels {
+			if !model.LabelName(name).IsValid() || reservedLabelNames[name] {
+				return nil, fmt.Errorf("invalid label name for target %d: %s", i, name)
+			}
+		}
+	}
+	for name := range c.Collectors {
+		if Flags.Lookup("collector."+name) == nil {
+			return nil, fmt.Errorf("unknown collector: %s", name)
+		}
+	}
+	if _, err := newQueueFilter(c.Queues.Include, c.Queues.Exclude); err != nil {
+		return nil, fmt.Errorf("invalid queue filter: %s", err)
+	}
+	if _, err := newRewriteRules(c.Queues.Rewrite); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	Flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
+
+// apply sets the flags to the values of the configuration, except for the
+// flags given on the command line. The collectors and the queue filters
+// missing from the configuration are reset to their defaults, so that removing
+// them from the configuration takes effect on reload. It returns a function
+// restoring the flags to their previous values, e.g. if the collectors can't
+// be built with the configuration.
+func (c *config) apply(explicit map[string]bool) (restore func()) {
+	previous := make(map[string]string)
+	previousRewriteRules := queueRewriteRules
+	setFlag := func(name, value string) {
+		if !explicit[name] && value != "" {
+			if _, ok := previous[name]; !ok {
+				previous[name] = Flags.Lookup(name).Value.String()
+			}
+			Flags.Set(name, value)
+		}
+	}
+
+	Flags.VisitAll(func(f *flag.Flag) {
+		if (strings.HasPrefix(f.Name, "collector.") || strings.HasPrefix(f.Name, "queue.")) && !explicit[f.Name] {
+			previous[f.Name] = f.Value.String()
+			Flags.Set(f.Name, f.DefValue)
+		}
+	})
+	for name, enabled := range c.Collectors {
+		setFlag("collector."+name, strconv.FormatBool(enabled))
+	}
+	setFlag("queue.include", c.Queues.Include)
+	setFlag("queue.exclude", c.Queues.Exclude)
+	setFlag("queue.static-list", strings.Join(c.Queues.Static, ","))
+	queueRewriteRules, _ = newRewriteRules(c.Queues.Rewrite)
+	setFlag("web.listen-address", c.Web.ListenAddress)
+	setFlag("web.telemetry-path", c.Web.TelemetryPath)
+
+	return func() {
+		for name, value := range previous {
+			Flags.Set(name, value)
+		}
+		queueRewriteRules = previousRewriteRules
+	}
+}
@@ -0,0 +1,183 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	consulAddress = Flags.String(
+		"consul.address",
+		"",
+		"URL of the Consul agent to register the exporter with as a service on startup, e.g. http://localhost:8500. The service is deregistered on shutdown.",
+	)
+	consulServiceName = Flags.String(
+		"consul.service-name",
+		"resque-exporter",
+		"Name of the service registered with Consul.",
+	)
+	consulServiceID = Flags.String(
+		"consul.service-id",
+		"",
+		"ID of the service registered with Consul. Defaults to <service name>-<hostname>-<port>.",
+	)
+	consulServiceAddress = Flags.String(
+		"consul.service-address",
+		"",
+		"Address of the exporter registered with Consul and checked by it. Defaults to the host of --web.listen-address, or localhost if it has no host.",
+	)
+	consulCheckInterval = Flags.Duration(
+		"consul.check-interval",
+		10*time.Second,
+		"Interval at which Consul checks /-/healthy of the exporter.",
+	)
+	consulTokenFile = Flags.String(
+		"consul.token-file",
+		"",
+		"File containing the ACL token to register the service with Consul.",
+	)
+	consulServiceTags = newStringsValue()
+)
+
+func init() {
+	Flags.Var(consulServiceTags, "consul.service-tag", "Tag of the service registered with Consul. Can be repeated.")
+}
+
+// consulService is a service registered with the agent API of Consul.
+type consulService struct {
+	ID      string             `json:"ID"`
+	Name    string             `json:"Name"`
+	Tags    []string           `json:"Tags,omitempty"`
+	Address string             `json:"Address"`
+	Port    int                `json:"Port"`
+	Check   consulServiceCheck `json:"Check"`
+}
+
+type consulServiceCheck struct {
+	HTTP          string `json:"HTTP"`
+	Interval      string `json:"Interval"`
+	TLSSkipVerify bool   `json:"TLSSkipVerify,omitempty"`
+}
+
+// consulRegistration registers the exporter with a Consul agent, with an HTTP
+// check of /-/healthy.
+type consulRegistration struct {
+	url     string
+	token   string
+	client  *http.Client
+	service consulService
+}
+
+// newConsulRegistration returns the registration of the server configured by
+// the flags.
+func newConsulRegistration(server *http.Server) (*consulRegistration, error) {
+	if strings.HasPrefix(*listenAddress, "unix://") {
+		return nil, fmt.Errorf("registering with Consul requires a TCP listen address: %s", *listenAddress)
+	}
+	host, portString, err := net.SplitHostPort(*listenAddress)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port of the listen address: %s", *listenAddress)
+	}
+
+	address := *consulServiceAddress
+	if address == "" {
+		address = host
+	}
+	if address == "" {
+		address = "localhost"
+	}
+
+	id := *consulServiceID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s-%s-%d", *consulServiceName, hostname, port)
+	}
+
+	var token string
+	if *consulTokenFile != "" {
+		if token, err = readToken(*consulTokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	scheme := "http"
+	if server.TLSConfig != nil {
+		scheme = "https"
+	}
+
+	return &consulRegistration{
+		url:    strings.TrimRight(*consulAddress, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+		service: consulService{
+			ID:      id,
+			Name:    *consulServiceName,
+			Tags:    consulServiceTags.values,
+			Address: address,
+			Port:    port,
+			Check: consulServiceCheck{
+				HTTP:     scheme + "://" + net.JoinHostPort(address, portString) + prefixPath("/-/healthy"),
+				Interval: consulCheckInterval.String(),
+				// The certificate of the exporter is for the
+				// names it is scraped by, which may not
+				// include the address registered.
+				TLSSkipVerify: scheme == "https",
+			},
+		},
+	}, nil
+}
+
+// register registers the service with the agent.
+func (c *consulRegistration) register(ctx context.Context) error {
+	b, err := json.Marshal(c.service)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "/v1/agent/service/register", bytes.NewReader(b))
+}
+
+// deregister deregisters the service from the agent.
+func (c *consulRegistration) deregister(ctx context.Context) error {
+	return c.do(ctx, "/v1/agent/service/deregister/"+c.service.ID, nil)
+}
+
+func (c *consulRegistration) do(ctx context.Context, path string, payload io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, c.url+path, payload)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
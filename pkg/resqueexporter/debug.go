@@ -0,0 +1,108 @@
+package resqueexporter
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// secretFlags are the flags whose values are never shown.
+var secretFlags = map[string]bool{
+	"web.auth-token": true,
+}
+
+// urlFlags are the flags whose values are URLs, shown without their
+// passwords.
+var urlFlags = map[string]bool{
+	"influxdb.url":       true,
+	"otlp.endpoint":      true,
+	"remote-write.url":   true,
+	"redis.fallback-url": true,
+	"redis.replica-url":  true,
+	"redis.url":          true,
+}
+
+// debugFlags serves the values of all the flags as a JSON object, with the
+// secrets redacted.
+func debugFlags(w http.ResponseWriter, r *http.Request) {
+	flags := make(map[string]string)
+	Flags.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case secretFlags[f.Name] && value != "":
+			value = redacted
+		case urlFlags[f.Name]:
+			var values []string
+			if v, ok := f.Value.(*stringsValue); ok {
+				values = append([]string(nil), v.values...)
+			} else if value != "" {
+				values = []string{value}
+			}
+			for i := range values {
+				values[i] = redactURL(values[i])
+			}
+			value = strings.Join(values, ",")
+		}
+		flags[f.Name] = value
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(flags); err != nil {
+		log.Errorf("Failed to write the flags: %s", err)
+	}
+}
+
+// effectiveConfig returns the configuration in effect, i.e. the targets
+// resolved from the configuration file and the flags, and the values of the
+// flags the configuration file can set. The passwords of the Redis URLs are
+// redacted.
+func (r *reloader) effectiveConfig() *config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &config{
+		Collectors: make(map[string]bool),
+		Queues: queuesConfig{
+			Include: *queueInclude,
+			Exclude: *queueExclude,
+			Static:  staticQueues(),
+		},
+		Web: webConfig{
+			ListenAddress: *listenAddress,
+			TelemetryPath: *metricPath,
+		},
+	}
+	for _, rule := range queueRewriteRules {
+		c.Queues.Rewrite = append(c.Queues.Rewrite, rule.config)
+	}
+	for _, target := range r.targets {
+		target.URL = redactURL(target.URL)
+		c.Targets = append(c.Targets, target)
+	}
+	Flags.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "collector.") {
+			enabled, _ := strconv.ParseBool(f.Value.String())
+			c.Collectors[strings.TrimPrefix(f.Name, "collector.")] = enabled
+		}
+	})
+	return c
+}
+
+// debugConfig serves the configuration in effect in the format of the
+// configuration file.
+func (r *reloader) debugConfig(w http.ResponseWriter, req *http.Request) {
+	b, err := yaml.Marshal(r.effectiveConfig())
+	if err != nil {
+		log.Errorf("Failed to marshal the configuration: %s", err)
+		http.Error(w, "Failed to marshal the configuration", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.Write(b)
+}
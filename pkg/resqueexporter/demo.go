@@ -0,0 +1,147 @@
+package resqueexporter
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	demo = Flags.Bool(
+		"demo",
+		false,
+		"Serve synthetic metrics of a made-up Resque without connecting to Redis, e.g. to develop dashboards or test alerting rules.",
+	)
+)
+
+// demoQueues are the queues of the made-up Resque, with the average numbers
+// of the jobs enqueued to them per scrape.
+var demoQueues = []struct {
+	name string
+	rate float64
+}{
+	{"critical", 5},
+	{"default", 40},
+	{"mailers", 20},
+	{"low", 10},
+	{"webhooks", 15},
+}
+
+// demoWorkers is the number of the workers of the made-up Resque.
+const demoWorkers = 12
+
+// demoCollector collects the metrics of a made-up Resque whose queues grow
+// and shrink randomly between the scrapes. It implements contextCollector.
+type demoCollector struct {
+	mu        sync.Mutex
+	rand      *rand.Rand
+	depths    []float64
+	failed    float64
+	processed float64
+	failures  float64
+}
+
+func newDemoCollector() *demoCollector {
+	return &demoCollector{
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		depths: make([]float64, len(demoQueues)),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *demoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- failedJobExecutionsDesc
+	ch <- failedQueuesDesc
+	ch <- jobExecutionsDesc
+	ch <- jobsInFailedQueueDesc
+	ch <- jobsInQueueDesc
+	ch <- jobsPendingDesc
+	ch <- queuesDesc
+	ch <- redisUpDesc
+	ch <- scrapeDurationDesc
+	ch <- upDesc
+	ch <- workersDesc
+	ch <- workingWorkersDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *demoCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(context.Background(), ch)
+}
+
+// collect advances the made-up Resque by a scrape, and collects its metrics.
+func (c *demoCollector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pending, working float64
+	for i, queue := range demoQueues {
+		enqueued := c.poisson(queue.rate)
+		// The workers are busy while there are jobs left, and
+		// sometimes fall behind the queues.
+		capacity := c.poisson(queue.rate * (0.8 + 0.4*c.rand.Float64()))
+		processed := capacity
+		if processed > c.depths[i]+enqueued {
+			processed = c.depths[i] + enqueued
+		}
+		c.depths[i] += enqueued - processed
+
+		failures := c.poisson(processed * 0.02)
+		c.processed += processed
+		c.failures += failures
+		c.failed += failures
+
+		pending += c.depths[i]
+		if c.depths[i] > 0 {
+			working += demoWorkers / float64(len(demoQueues))
+		}
+		ch <- prometheus.MustNewConstMetric(jobsInQueueDesc, prometheus.GaugeValue, c.depths[i], queue.name)
+	}
+	if working > demoWorkers {
+		working = demoWorkers
+	}
+	// The failed jobs are cleared once in a while.
+	if c.rand.Float64() < 0.01 {
+		c.failed = 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(queuesDesc, prometheus.GaugeValue, float64(len(demoQueues)))
+	ch <- prometheus.MustNewConstMetric(jobsPendingDesc, prometheus.GaugeValue, pending)
+	ch <- prometheus.MustNewConstMetric(jobExecutionsDesc, prometheus.CounterValue, c.processed)
+	ch <- prometheus.MustNewConstMetric(failedJobExecutionsDesc, prometheus.CounterValue, c.failures)
+	ch <- prometheus.MustNewConstMetric(failedQueuesDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(jobsInFailedQueueDesc, prometheus.GaugeValue, c.failed, "failed")
+	ch <- prometheus.MustNewConstMetric(workersDesc, prometheus.GaugeValue, demoWorkers)
+	ch <- prometheus.MustNewConstMetric(workingWorkersDesc, prometheus.GaugeValue, float64(int(working)))
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, 0.005+0.01*c.rand.Float64())
+	ch <- prometheus.MustNewConstMetric(redisUpDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+}
+
+// poisson returns a random number of events of a Poisson distribution with
+// the mean, approximated by a normal distribution for large means.
+func (c *demoCollector) poisson(mean float64) float64 {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 30 {
+		n := mean + c.rand.NormFloat64()*math.Sqrt(mean)
+		if n < 0 {
+			return 0
+		}
+		return float64(int(n + 0.5))
+	}
+	// Knuth's algorithm.
+	l, p, k := math.Exp(-mean), 1.0, 0.0
+	for {
+		p *= c.rand.Float64()
+		if p <= l {
+			return k
+		}
+		k++
+	}
+}
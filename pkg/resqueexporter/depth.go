@@ -0,0 +1,242 @@
+package resqueexporter
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	scrapeDepthWindow = Flags.Duration(
+		"scrape.depth-window",
+		time.Minute,
+		"Window over which the minimum and maximum numbers of jobs in the queues are observed by the background scrapes, e.g. the scrape interval of Prometheus. Only used with --scrape.interval.",
+	)
+)
+
+var (
+	queueMinJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "min_jobs"),
+		"Minimum number of jobs in a queue observed by the background scrapes in the window.",
+		[]string{"queue"}, nil,
+	)
+	queueMaxJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "max_jobs"),
+		"Maximum number of jobs in a queue observed by the background scrapes in the window.",
+		[]string{"queue"}, nil,
+	)
+	queueJobsAddedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "jobs_added_total"),
+		"Total increase of the number of jobs in a queue between the background scrapes.",
+		[]string{"queue"}, nil,
+	)
+	queueJobsRemovedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "jobs_removed_total"),
+		"Total decrease of the number of jobs in a queue between the background scrapes.",
+		[]string{"queue"}, nil,
+	)
+	queueNetEnqueueRateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "net_enqueue_rate"),
+		"Change of the number of jobs in a queue per second between the last two background scrapes.",
+		[]string{"queue"}, nil,
+	)
+	estimatedEnqueuedJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "estimated_enqueued_jobs_total"),
+		"Estimated total number of jobs enqueued to all the queues, from the changes of the numbers of pending and executed jobs between the background scrapes.",
+		nil, nil,
+	)
+)
+
+// describeDepths describes the metrics derived from the background scrapes.
+func describeDepths(ch chan<- *prometheus.Desc) {
+	ch <- queueMinJobsDesc
+	ch <- queueMaxJobsDesc
+	ch <- queueJobsAddedDesc
+	ch <- queueJobsRemovedDesc
+	ch <- queueNetEnqueueRateDesc
+	ch <- estimatedEnqueuedJobsDesc
+}
+
+// depthObservation is a number of jobs in a queue observed by a background
+// scrape.
+type depthObservation struct {
+	time time.Time
+	jobs float64
+}
+
+// queueDepth is the numbers of jobs in a queue observed by the background
+// scrapes.
+type queueDepth struct {
+	labels       []*dto.LabelPair
+	observations []depthObservation
+	added        float64
+	removed      float64
+	rate         float64
+	hasRate      bool
+}
+
+// jobTotals is the numbers of pending and executed jobs of a namespace
+// observed by the last background scrape.
+type jobTotals struct {
+	time              time.Time
+	pending, executed float64
+	enqueued          float64
+}
+
+// depthTracker tracks the changes of the numbers of jobs in the queues between
+// the background scrapes, which are invisible to the scrapes of the exporter
+// less frequent than them.
+type depthTracker struct {
+	mu     sync.Mutex
+	queues map[string]*queueDepth
+	totals map[string]*jobTotals
+}
+
+// observe returns the metrics of a background scrape with the metrics derived
+// from the numbers of jobs observed by the background scrapes.
+func (t *depthTracker) observe(metrics []prometheus.Metric, now time.Time) []prometheus.Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.queues == nil {
+		t.queues = make(map[string]*queueDepth)
+		t.totals = make(map[string]*jobTotals)
+	}
+
+	var derived []prometheus.Metric
+	pending := make(map[string]float64)
+	executed := make(map[string]float64)
+	labels := make(map[string][]*dto.LabelPair)
+	for _, m := range metrics {
+		desc := m.Desc()
+		if desc != jobsInQueueDesc && desc != jobsPendingDesc && desc != jobExecutionsDesc {
+			continue
+		}
+		var out dto.Metric
+		if err := m.Write(&out); err != nil {
+			continue
+		}
+		key := labelsKey(out.Label, "queue")
+
+		switch desc {
+		case jobsInQueueDesc:
+			derived = append(derived, t.observeQueue(labelsKey(out.Label, ""), out.Label, out.GetGauge().GetValue(), now)...)
+		case jobsPendingDesc:
+			pending[key], labels[key] = out.GetGauge().GetValue(), out.Label
+		case jobExecutionsDesc:
+			executed[key] = out.GetCounter().GetValue()
+		}
+	}
+
+	// The jobs executed between the scrapes have been enqueued as well as
+	// the ones added to the pending jobs.
+	for key, p := range pending {
+		e, ok := executed[key]
+		if !ok {
+			continue
+		}
+		totals, ok := t.totals[key]
+		if !ok {
+			totals = &jobTotals{}
+			t.totals[key] = totals
+		} else if e >= totals.executed {
+			if increase := p - totals.pending + e - totals.executed; increase > 0 {
+				totals.enqueued += increase
+			}
+		}
+		totals.time, totals.pending, totals.executed = now, p, e
+		derived = append(derived, derivedMetric(estimatedEnqueuedJobsDesc, labels[key], &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(totals.enqueued)}}))
+	}
+
+	// The queues and the namespaces no longer observed are forgotten after
+	// the window.
+	for key, q := range t.queues {
+		if last := q.observations[len(q.observations)-1]; now.Sub(last.time) > *scrapeDepthWindow {
+			delete(t.queues, key)
+		}
+	}
+	for key, totals := range t.totals {
+		if now.Sub(totals.time) > *scrapeDepthWindow {
+			delete(t.totals, key)
+		}
+	}
+
+	return append(metrics, derived...)
+}
+
+// observeQueue records the number of jobs in the queue, and returns the metrics
+// derived from the numbers of jobs observed in the window.
+func (t *depthTracker) observeQueue(key string, labels []*dto.LabelPair, jobs float64, now time.Time) []prometheus.Metric {
+	q, ok := t.queues[key]
+	if !ok {
+		q = &queueDepth{labels: labels}
+		t.queues[key] = q
+	} else {
+		last := q.observations[len(q.observations)-1]
+		change := jobs - last.jobs
+		if change > 0 {
+			q.added += change
+		} else {
+			q.removed -= change
+		}
+		if elapsed := now.Sub(last.time).Seconds(); elapsed > 0 {
+			q.rate, q.hasRate = change/elapsed, true
+		}
+	}
+
+	q.observations = append(q.observations, depthObservation{now, jobs})
+	for len(q.observations) > 1 && now.Sub(q.observations[0].time) > *scrapeDepthWindow {
+		q.observations = q.observations[1:]
+	}
+	min, max := jobs, jobs
+	for _, o := range q.observations {
+		if o.jobs < min {
+			min = o.jobs
+		}
+		if o.jobs > max {
+			max = o.jobs
+		}
+	}
+
+	metrics := []prometheus.Metric{
+		derivedMetric(queueMinJobsDesc, labels, &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(min)}}),
+		derivedMetric(queueMaxJobsDesc, labels, &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(max)}}),
+		derivedMetric(queueJobsAddedDesc, labels, &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(q.added)}}),
+		derivedMetric(queueJobsRemovedDesc, labels, &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(q.removed)}}),
+	}
+	if q.hasRate {
+		metrics = append(metrics, derivedMetric(queueNetEnqueueRateDesc, labels, &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(q.rate)}}))
+	}
+	return metrics
+}
+
+// reset forgets the numbers of jobs observed.
+func (t *depthTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.queues, t.totals = nil, nil
+}
+
+// derivedMetric returns a metric of the desc with the labels of the metric it
+// is derived from, including the ones added by the targets and the
+// namespaces.
+func derivedMetric(desc *prometheus.Desc, labels []*dto.LabelPair, m *dto.Metric) prometheus.Metric {
+	m.Label = labels
+	return &summedMetric{desc: desc, metric: m}
+}
+
+// labelsKey returns a key of the labels but the given one.
+func labelsKey(labels []*dto.LabelPair, except string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if l.GetName() != except {
+			pairs = append(pairs, l.GetName()+"="+l.GetValue())
+		}
+	}
+	return strings.Join(pairs, "\xff")
+}
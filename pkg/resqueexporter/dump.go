@@ -0,0 +1,261 @@
+package resqueexporter
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/common/version"
+)
+
+const (
+	// dumpSampleSize is the number of the jobs, the failed jobs and the
+	// delayed timestamps sampled by the dump.
+	dumpSampleSize = 5
+	// dumpPayloadLimit is the maximum number of the bytes of the payloads
+	// of the jobs in the dump.
+	dumpPayloadLimit = 1024
+)
+
+// resqueDump is a snapshot of the Redis keys of Resque of all the targets.
+type resqueDump struct {
+	Version string       `json:"version"`
+	Time    time.Time    `json:"time"`
+	Targets []targetDump `json:"targets"`
+}
+
+// targetDump is a snapshot of the Redis keys of a namespace of a target. The
+// URL of the target is stripped of its credentials.
+type targetDump struct {
+	Target       string            `json:"target"`
+	Namespace    string            `json:"namespace"`
+	Error        string            `json:"error,omitempty"`
+	Stats        map[string]string `json:"stats,omitempty"`
+	Queues       []queueDump       `json:"queues,omitempty"`
+	FailedQueues []failedQueueDump `json:"failed_queues,omitempty"`
+	Workers      []workerDump      `json:"workers,omitempty"`
+	Scheduler    *schedulerDump    `json:"scheduler,omitempty"`
+}
+
+type queueDump struct {
+	Name   string          `json:"name"`
+	Length int64           `json:"length"`
+	Head   []dumpedPayload `json:"head"`
+}
+
+type failedQueueDump struct {
+	Name   string      `json:"name"`
+	Length int64       `json:"length"`
+	Recent []failedJob `json:"recent"`
+}
+
+type workerDump struct {
+	ID      string         `json:"id"`
+	Started string         `json:"started,omitempty"`
+	Job     *dumpedPayload `json:"job,omitempty"`
+}
+
+// schedulerDump is a snapshot of the delayed jobs of resque-scheduler.
+type schedulerDump struct {
+	DelayedTimestamps int64         `json:"delayed_timestamps"`
+	Next              []delayedDump `json:"next"`
+	Schedules         []string      `json:"schedules,omitempty"`
+}
+
+type delayedDump struct {
+	Timestamp int64 `json:"timestamp"`
+	Jobs      int64 `json:"jobs"`
+}
+
+// dumpedPayload is a payload truncated to dumpPayloadLimit bytes.
+type dumpedPayload struct {
+	Payload   string `json:"payload"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func newDumpedPayload(payload string) dumpedPayload {
+	p, truncated := truncatePayload(payload, dumpPayloadLimit)
+	return dumpedPayload{Payload: p, Truncated: truncated}
+}
+
+// dump writes a snapshot of the Redis keys of Resque of all the namespaces of
+// all the targets as JSON, e.g. to attach to a bug report. The errors of a
+// namespace are recorded in its snapshot.
+func (r *reloader) dump(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d := resqueDump{Version: version.Version, Time: time.Now().UTC(), Targets: []targetDump{}}
+	for i, exporter := range r.exporters {
+		namespaces := exporter.redisNamespaces
+		if *discoverNamespaces {
+			var err error
+			if namespaces, err = exporter.namespaces(); err != nil {
+				d.Targets = append(d.Targets, targetDump{Target: redactedURL(r.targets[i].URL).String(), Error: err.Error()})
+				continue
+			}
+		}
+		if namespaces == nil {
+			namespaces = []string{exporter.redisNamespace}
+		}
+		for _, ns := range namespaces {
+			t := targetDump{Target: redactedURL(r.targets[i].URL).String(), Namespace: ns}
+			if err := exporter.withNamespace(ns).dump(&t); err != nil {
+				t.Error = err.Error()
+			}
+			d.Targets = append(d.Targets, t)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// dump fills the snapshot with the keys of the namespace, returning the first
+// error.
+func (e *Collector) dump(t *targetDump) error {
+	stats := []string{"processed", "failed"}
+	t.Stats = make(map[string]string)
+	for _, name := range stats {
+		v, err := e.redisClient.Get(e.redisKey("stat", name)).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t.Stats[name] = v
+	}
+
+	queues, err := e.setMembers(e.redisKey("queues"))
+	if err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		q, err := e.dumpQueue(queue)
+		if err != nil {
+			return err
+		}
+		t.Queues = append(t.Queues, q)
+	}
+
+	failedQueues, err := e.failedQueues()
+	if err != nil {
+		return err
+	}
+	for _, failedQueue := range failedQueues {
+		length, err := e.redisClient.LLen(e.redisKey(failedQueue)).Result()
+		if err != nil {
+			return err
+		}
+		recent, err := e.recentFailedJobs(failedQueue, "", dumpSampleSize)
+		if err != nil {
+			return err
+		}
+		t.FailedQueues = append(t.FailedQueues, failedQueueDump{Name: failedQueue, Length: length, Recent: recent})
+	}
+
+	if t.Workers, err = e.dumpWorkers(); err != nil {
+		return err
+	}
+	if t.Scheduler, err = e.dumpScheduler(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Collector) dumpQueue(queue string) (queueDump, error) {
+	key := e.redisKey("queue", queue)
+	length, err := e.redisClient.LLen(key).Result()
+	if err != nil {
+		return queueDump{}, err
+	}
+	payloads, err := e.redisClient.LRange(key, 0, dumpSampleSize-1).Result()
+	if err != nil {
+		return queueDump{}, err
+	}
+	q := queueDump{Name: queue, Length: length, Head: []dumpedPayload{}}
+	for _, payload := range payloads {
+		q.Head = append(q.Head, newDumpedPayload(payload))
+	}
+	return q, nil
+}
+
+// dumpWorkers returns the workers with the jobs they are working, getting them
+// in pipelines.
+func (e *Collector) dumpWorkers() ([]workerDump, error) {
+	workers, err := e.setMembers(e.redisKey("workers"))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*redis.StringCmd, len(workers))
+	started := make([]*redis.StringCmd, len(workers))
+	err = e.pipelined(len(workers), func(pipe redis.Pipeliner, i int) {
+		jobs[i] = pipe.Get(e.redisKey("worker", workers[i]))
+		started[i] = pipe.Get(e.redisKey("worker", workers[i], "started"))
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	dumps := make([]workerDump, len(workers))
+	for i, worker := range workers {
+		dumps[i] = workerDump{ID: worker, Started: started[i].Val()}
+		if job := jobs[i].Val(); job != "" {
+			p := newDumpedPayload(job)
+			dumps[i].Job = &p
+		}
+	}
+	return dumps, nil
+}
+
+// dumpScheduler returns the next timestamps of the jobs delayed by
+// resque-scheduler and the names of its schedules, or nil if it is not used.
+func (e *Collector) dumpScheduler() (*schedulerDump, error) {
+	timestamps, err := e.redisClient.ZRange(e.redisKey("delayed_queue_schedule"), 0, dumpSampleSize-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmd := redis.NewStringSliceCmd("hkeys", e.redisKey("schedules"))
+	if err := e.redisClient.Process(cmd); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	schedules := cmd.Val()
+	if len(timestamps) == 0 && len(schedules) == 0 {
+		return nil, nil
+	}
+
+	s := &schedulerDump{Next: []delayedDump{}, Schedules: schedules}
+	count := redis.NewIntCmd("zcard", e.redisKey("delayed_queue_schedule"))
+	if err := e.redisClient.Process(count); err != nil {
+		return nil, err
+	}
+	s.DelayedTimestamps = count.Val()
+	for _, timestamp := range timestamps {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		jobs, err := e.redisClient.LLen(e.redisKey("delayed", timestamp)).Result()
+		if err != nil {
+			return nil, err
+		}
+		s.Next = append(s.Next, delayedDump{Timestamp: ts, Jobs: jobs})
+	}
+	return s, nil
+}
+
+// runDump writes the snapshot of the targets configured by the flags to the
+// writer.
+func runDump(w io.Writer) error {
+	r, err := newReloader(explicitFlags())
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	return r.dump(w)
+}
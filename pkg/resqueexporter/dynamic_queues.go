@@ -0,0 +1,142 @@
+package resqueexporter
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueEligibleWorkersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "queue_eligible_workers"),
+		"Number of workers whose queue patterns match a queue.",
+		[]string{"queue"}, nil,
+	)
+	workerPatternQueuesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "worker_pattern_queues"),
+		"Number of queues matched by a queue pattern of workers.",
+		[]string{"pattern"}, nil,
+	)
+)
+
+func init() {
+	registerCollector("dynamic-queues", false, "Collect the queues matched by the queue patterns of workers, as expanded by resque-dynamic-queues.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		if s.queuesErr != nil {
+			return errQueuesNotCollected
+		}
+		if s.workersErr != nil {
+			return errWorkersNotCollected
+		}
+		return e.scrapeDynamicQueues(ch, s.filter.filter(s.queues), s.workers)
+	})
+}
+
+func (e *Collector) scrapeDynamicQueues(ch chan<- prometheus.Metric, queues, workers []string) error {
+	values, err := e.redisClient.HGetAll(e.redisKey("dynamic_queue")).Result()
+	if err != nil {
+		return err
+	}
+
+	dynamicQueues := make(map[string][]string, len(values))
+	for key, value := range values {
+		var patterns []string
+		if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+			e.skipKey(e.redisKey("dynamic_queue")+" "+key, skipInvalidJSON, err)
+			continue
+		}
+		dynamicQueues[key] = patterns
+	}
+
+	sort.Strings(queues)
+
+	eligibleWorkers := make(map[string]int, len(queues))
+	patternQueues := make(map[string]int)
+	for _, worker := range workers {
+		// Worker IDs look like <hostname>:<pid>:<queue>,<queue>,...
+		parts := strings.SplitN(worker, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		patterns := strings.Split(parts[2], ",")
+
+		for _, queue := range expandQueues(patterns, queues, dynamicQueues) {
+			eligibleWorkers[queue]++
+		}
+		for _, pattern := range patterns {
+			if _, ok := patternQueues[pattern]; !ok {
+				patternQueues[pattern] = len(expandQueues([]string{pattern}, queues, dynamicQueues))
+			}
+		}
+	}
+
+	for _, queue := range queues {
+		ch <- prometheus.MustNewConstMetric(queueEligibleWorkersDesc, prometheus.GaugeValue, float64(eligibleWorkers[queue]), queue)
+	}
+	for pattern, n := range patternQueues {
+		ch <- prometheus.MustNewConstMetric(workerPatternQueuesDesc, prometheus.GaugeValue, float64(n), pattern)
+	}
+
+	return nil
+}
+
+// expandQueues expands the queue patterns of a worker into the queues it
+// works, following the rules of resque-dynamic-queues: "@key" refers to the
+// patterns stored under key in the dynamic_queue hash ("@" alone refers to
+// "default"), "!" negates a pattern, and patterns are matched as globs
+// against the given sorted queues.
+func expandQueues(patterns, queues []string, dynamicQueues map[string][]string) []string {
+	matched := make(map[string]bool)
+	var order []string
+
+	pending := append([]string(nil), patterns...)
+	for len(pending) > 0 {
+		pattern := strings.TrimSpace(pending[0])
+		pending = pending[1:]
+
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+
+		if strings.HasPrefix(pattern, "@") {
+			key := strings.TrimSpace(pattern[1:])
+			if key == "" {
+				key = "default"
+			}
+			for _, p := range dynamicQueues[key] {
+				if negated {
+					if strings.HasPrefix(p, "!") {
+						p = p[1:]
+					} else {
+						p = "!" + p
+					}
+				}
+				pending = append(pending, p)
+			}
+			continue
+		}
+
+		for _, queue := range queues {
+			if ok, _ := path.Match(pattern, queue); !ok {
+				continue
+			}
+			if negated {
+				delete(matched, queue)
+			} else if !matched[queue] {
+				matched[queue] = true
+				order = append(order, queue)
+			}
+		}
+	}
+
+	var expanded []string
+	for _, queue := range order {
+		if matched[queue] {
+			expanded = append(expanded, queue)
+		}
+	}
+	return expanded
+}
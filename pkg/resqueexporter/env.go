@@ -0,0 +1,71 @@
+package resqueexporter
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const envPrefix = "RESQUE_EXPORTER_"
+
+// envName returns the name of the environment variable setting the flag, e.g.
+// RESQUE_EXPORTER_WEB_LISTEN_ADDRESS for --web.listen-address.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// lookupEnv returns the value of the environment variable. Following the
+// convention of Docker secrets, the value is read from the file given by the
+// variable suffixed with _FILE if the variable itself is not set.
+func lookupEnv(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	filename, ok := os.LookupEnv(name + "_FILE")
+	if !ok {
+		return "", false, nil
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s_FILE: %s", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// setFlagsFromEnv sets the flags not given on the command line to the values
+// of their environment variables.
+func setFlagsFromEnv() error {
+	explicit := explicitFlags()
+
+	// The password file given by REDIS_PASSWORD_FILE is re-read when
+	// connecting like the one given by the flag, so that rotated passwords
+	// are picked up.
+	if filename := os.Getenv("REDIS_PASSWORD_FILE"); filename != "" && !explicit["redis.password-file"] {
+		Flags.Set("redis.password-file", filename)
+	}
+
+	var err error
+	Flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		value, ok, e := lookupEnv(name)
+		if e != nil {
+			err = e
+		} else if ok {
+			if e := Flags.Set(f.Name, value); e != nil {
+				// The secrets and the URLs with credentials
+				// are not repeated in the error.
+				if secretFlags[f.Name] || urlFlags[f.Name] {
+					err = fmt.Errorf("invalid value for %s: %s", name, e)
+				} else {
+					err = fmt.Errorf("invalid value %q for %s: %s", value, name, e)
+				}
+			}
+		}
+	})
+	return err
+}
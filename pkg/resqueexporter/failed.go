@@ -0,0 +1,231 @@
+package resqueexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	enableFailedAPI = Flags.Bool(
+		"web.enable-failed-api",
+		false,
+		"Enable the API returning the most recent failed jobs at /api/v1/failed.",
+	)
+)
+
+const (
+	// failedAPIDefaultLimit and failedAPIMaxLimit are the default and the
+	// maximum numbers of the failed jobs returned by the API.
+	failedAPIDefaultLimit = 10
+	failedAPIMaxLimit     = 100
+	// failedAPIScanLimit is the maximum number of the entries of a failed
+	// queue read to find the failed jobs of a queue.
+	failedAPIScanLimit = 1000
+	// failedAPIPayloadLimit is the maximum number of the bytes of the
+	// payloads of the failed jobs returned by the API.
+	failedAPIPayloadLimit = 1024
+)
+
+// failedJob is a failed job returned by the API.
+type failedJob struct {
+	Target           string `json:"target,omitempty"`
+	Namespace        string `json:"namespace,omitempty"`
+	FailedQueue      string `json:"failed_queue"`
+	Queue            string `json:"queue"`
+	Class            string `json:"class"`
+	Exception        string `json:"exception"`
+	Error            string `json:"error"`
+	Worker           string `json:"worker,omitempty"`
+	FailedAt         string `json:"failed_at"`
+	Payload          string `json:"payload"`
+	PayloadTruncated bool   `json:"payload_truncated,omitempty"`
+
+	failedAt time.Time
+}
+
+// failure is an entry of a failed queue saved by the failure backends of
+// Resque.
+type failure struct {
+	FailedAt  string          `json:"failed_at"`
+	Payload   json.RawMessage `json:"payload"`
+	Exception string          `json:"exception"`
+	Error     string          `json:"error"`
+	Worker    string          `json:"worker"`
+	Queue     string          `json:"queue"`
+}
+
+// parseFailedJob parses an entry of a failed queue.
+func parseFailedJob(entry string) (failedJob, error) {
+	var f failure
+	if err := json.Unmarshal([]byte(entry), &f); err != nil {
+		return failedJob{}, err
+	}
+	var payload struct {
+		Class string `json:"class"`
+	}
+	json.Unmarshal(f.Payload, &payload)
+
+	job := failedJob{
+		Queue:     f.Queue,
+		Class:     payload.Class,
+		Exception: f.Exception,
+		Error:     f.Error,
+		Worker:    f.Worker,
+		FailedAt:  f.FailedAt,
+		Payload:   string(f.Payload),
+	}
+	job.Payload, job.PayloadTruncated = truncatePayload(job.Payload, failedAPIPayloadLimit)
+	// Resque formats the times like 2006/01/02 15:04:05 UTC.
+	for _, layout := range []string{"2006/01/02 15:04:05 MST", "2006/01/02 15:04:05 -0700", time.RFC3339} {
+		if t, err := time.Parse(layout, f.FailedAt); err == nil {
+			job.failedAt = t
+			break
+		}
+	}
+	return job, nil
+}
+
+// truncatePayload truncates the payload to at most limit bytes without
+// splitting a UTF-8 character, and reports whether it was truncated.
+func truncatePayload(payload string, limit int) (string, bool) {
+	if len(payload) <= limit {
+		return payload, false
+	}
+	n := limit
+	for n > 0 && !utf8.RuneStart(payload[n]) {
+		n--
+	}
+	return payload[:n], true
+}
+
+// recentFailedJobs returns the most recent failed jobs of the queue, or of all
+// the queues if the queue is empty, in the failed queue, newest first.
+func (e *Collector) recentFailedJobs(failedQueue, queue string, limit int) ([]failedJob, error) {
+	key := e.redisKey(failedQueue)
+	length, err := e.redisClient.LLen(key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// The failures are appended to the failed queues, so they are read
+	// from the tail.
+	var jobs []failedJob
+	for end := length; end > 0 && len(jobs) < limit && length-end < failedAPIScanLimit; end -= failedAPIMaxLimit {
+		start := end - failedAPIMaxLimit
+		if start < 0 {
+			start = 0
+		}
+		entries, err := e.redisClient.LRange(key, start, end-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i := len(entries) - 1; i >= 0 && len(jobs) < limit; i-- {
+			job, err := parseFailedJob(entries[i])
+			if err != nil {
+				e.logger.Debugf("Failed to parse an entry of %s: %s", key, err)
+				continue
+			}
+			if queue != "" && job.Queue != queue {
+				continue
+			}
+			job.FailedQueue, job.Namespace = failedQueue, e.redisNamespace
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// failedJobs returns the most recent failed jobs of the queue, or of all the
+// queues if the queue is empty, in the failed queues of all the namespaces of
+// all the targets, newest first.
+func (r *reloader) failedJobs(ctx context.Context, queue string, limit int) ([]failedJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobs := []failedJob{}
+	for i, exporter := range r.exporters {
+		client, _ := exporter.redisEndpoints.get()
+		exporter = exporter.withClient(contextClient(ctx, client))
+
+		exporters := []*Collector{exporter}
+		if exporter.redisNamespaces != nil {
+			exporters = nil
+			for _, ns := range exporter.redisNamespaces {
+				exporters = append(exporters, exporter.withNamespace(ns))
+			}
+		}
+		for _, e := range exporters {
+			failedQueues, err := e.failedQueues()
+			if err != nil {
+				return nil, err
+			}
+			for _, failedQueue := range failedQueues {
+				recent, err := e.recentFailedJobs(failedQueue, queue, limit)
+				if err != nil {
+					return nil, err
+				}
+				for _, job := range recent {
+					if exporter.redisNamespaces == nil {
+						job.Namespace = ""
+					}
+					if len(r.targets) > 1 {
+						job.Target = redactedURL(r.targets[i].URL).String()
+					}
+					jobs = append(jobs, job)
+				}
+			}
+		}
+	}
+	// The commands are skipped without errors once the context is done.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].failedAt.After(jobs[j].failedAt)
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// serveFailedJobs serves the most recent failed jobs as JSON. The number of
+// the jobs is given by the limit parameter, and the queue the jobs failed in
+// by the queue parameter.
+func (r *reloader) serveFailedJobs(w http.ResponseWriter, req *http.Request) {
+	limit := failedAPIDefaultLimit
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", v), http.StatusBadRequest)
+			return
+		}
+		if n > failedAPIMaxLimit {
+			n = failedAPIMaxLimit
+		}
+		limit = n
+	}
+
+	jobs, err := r.failedJobs(req.Context(), req.URL.Query().Get("queue"), limit)
+	if err != nil {
+		log.Errorf("Failed to get the failed jobs: %s", err)
+		http.Error(w, fmt.Sprintf("Failed to get the failed jobs: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Jobs []failedJob `json:"jobs"`
+	}{jobs}); err != nil {
+		log.Errorf("Failed to write the failed jobs: %s", err)
+	}
+}
@@ -0,0 +1,438 @@
+package resqueexporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a Redis server for the tests, serving the commands the
+// collectors run against the keys seeded by the tests over RESP. Unlike a fake
+// client, it exercises the clients, the pipelines and the iterators of
+// go-redis like a real Redis.
+type fakeRedis struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu   sync.Mutex
+	data map[string]interface{}
+	// commands are the names of the commands received, e.g. to assert
+	// on the round trips.
+	commands []string
+}
+
+// The values of the keys are of these types.
+type (
+	fakeList []string
+	fakeSet  map[string]bool
+	fakeHash map[string]string
+	fakeZSet map[string]float64
+)
+
+const wrongTypeReply = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// newFakeRedis starts a fake Redis closed when the test finishes.
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{t: t, ln: ln, data: make(map[string]interface{})}
+	go r.serve()
+	t.Cleanup(func() { ln.Close() })
+	return r
+}
+
+// url returns the URL of the fake Redis.
+func (r *fakeRedis) url() string {
+	return "redis://" + r.ln.Addr().String()
+}
+
+func (r *fakeRedis) set(key, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = value
+}
+
+func (r *fakeRedis) rpush(key string, values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, _ := r.data[key].(fakeList)
+	r.data[key] = append(l, values...)
+}
+
+func (r *fakeRedis) sadd(key string, members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.data[key].(fakeSet)
+	if !ok {
+		s = make(fakeSet)
+		r.data[key] = s
+	}
+	for _, member := range members {
+		s[member] = true
+	}
+}
+
+func (r *fakeRedis) hset(key, field, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.data[key].(fakeHash)
+	if !ok {
+		h = make(fakeHash)
+		r.data[key] = h
+	}
+	h[field] = value
+}
+
+func (r *fakeRedis) zadd(key string, score float64, member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	z, ok := r.data[key].(fakeZSet)
+	if !ok {
+		z = make(fakeZSet)
+		r.data[key] = z
+	}
+	z[member] = score
+}
+
+func (r *fakeRedis) del(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, key)
+}
+
+// received returns the names of the commands received so far.
+func (r *fakeRedis) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+func (r *fakeRedis) serve() {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			return
+		}
+		go r.serveConn(conn)
+	}
+}
+
+func (r *fakeRedis) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		r.exec(w, args)
+		// The replies to the commands of a pipeline are flushed once
+		// all of them are read.
+		if rd.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected line: %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(rd)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Replies of RESP.
+type (
+	respStatus string
+	respError  string
+)
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case respStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case respError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			writeReply(w, s)
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported reply: %#v", reply))
+	}
+}
+
+func (r *fakeRedis) exec(w *bufio.Writer, args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := strings.ToLower(args[0])
+	r.commands = append(r.commands, name)
+	writeReply(w, r.reply(name, args[1:]))
+}
+
+// reply returns the reply to the command. It is called with r.mu held.
+func (r *fakeRedis) reply(name string, args []string) interface{} {
+	switch name {
+	case "ping":
+		return respStatus("PONG")
+	case "auth", "select", "client", "unwatch":
+		return respStatus("OK")
+	case "config":
+		return []string{}
+	case "time":
+		now := time.Now()
+		return []string{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+	case "exists":
+		var n int
+		for _, key := range args {
+			if _, ok := r.data[key]; ok {
+				n++
+			}
+		}
+		return n
+	case "type":
+		switch r.data[args[0]].(type) {
+		case string:
+			return respStatus("string")
+		case fakeList:
+			return respStatus("list")
+		case fakeSet:
+			return respStatus("set")
+		case fakeHash:
+			return respStatus("hash")
+		case fakeZSet:
+			return respStatus("zset")
+		}
+		return respStatus("none")
+	case "memory":
+		if _, ok := r.data[args[1]]; !ok {
+			return nil
+		}
+		return 64
+	case "scan":
+		return []interface{}{"0", r.match(r.keys(), args[1:])}
+	}
+
+	if len(args) == 0 {
+		return respError("ERR wrong number of arguments for '" + name + "' command")
+	}
+	value := r.data[args[0]]
+	switch name {
+	case "get":
+		if value == nil {
+			return nil
+		}
+		if s, ok := value.(string); ok {
+			return s
+		}
+	case "llen", "lrange":
+		l, ok := value.(fakeList)
+		if value != nil && !ok {
+			break
+		}
+		if name == "llen" {
+			return len(l)
+		}
+		return []string(rangeOf(l, args[1], args[2]))
+	case "scard", "smembers", "sscan":
+		s, ok := value.(fakeSet)
+		if value != nil && !ok {
+			break
+		}
+		members := make([]string, 0, len(s))
+		for member := range s {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		switch name {
+		case "scard":
+			return len(members)
+		case "smembers":
+			return members
+		}
+		return []interface{}{"0", r.match(members, args[2:])}
+	case "hgetall", "hlen", "hkeys":
+		h, ok := value.(fakeHash)
+		if value != nil && !ok {
+			break
+		}
+		fields := make([]string, 0, len(h))
+		for field := range h {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		switch name {
+		case "hlen":
+			return len(fields)
+		case "hkeys":
+			return fields
+		}
+		var pairs []string
+		for _, field := range fields {
+			pairs = append(pairs, field, h[field])
+		}
+		return pairs
+	case "zcard", "zrange":
+		z, ok := value.(fakeZSet)
+		if value != nil && !ok {
+			break
+		}
+		members := make([]string, 0, len(z))
+		for member := range z {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if z[members[i]] != z[members[j]] {
+				return z[members[i]] < z[members[j]]
+			}
+			return members[i] < members[j]
+		})
+		if name == "zcard" {
+			return len(members)
+		}
+		return rangeOf(members, args[1], args[2])
+	default:
+		return respError("ERR unknown command '" + name + "'")
+	}
+	return respError(wrongTypeReply)
+}
+
+// keys returns all the keys in order. It is called with r.mu held.
+func (r *fakeRedis) keys() []string {
+	keys := make([]string, 0, len(r.data))
+	for key := range r.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match returns the values matching the MATCH option of a SCAN command.
+func (r *fakeRedis) match(values []string, options []string) []string {
+	pattern := "*"
+	for i := 0; i+1 < len(options); i += 2 {
+		if strings.EqualFold(options[i], "match") {
+			pattern = options[i+1]
+		}
+	}
+	matched := []string{}
+	for _, v := range values {
+		if globMatch(pattern, v) {
+			matched = append(matched, v)
+		}
+	}
+	return matched
+}
+
+// rangeOf returns the elements from start to stop inclusive, which can be
+// negative to count from the end, like LRANGE.
+func rangeOf(values []string, start, stop string) []string {
+	n := len(values)
+	i, _ := strconv.Atoi(start)
+	j, _ := strconv.Atoi(stop)
+	if i < 0 {
+		i += n
+	}
+	if j < 0 {
+		j += n
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j >= n {
+		j = n - 1
+	}
+	if i > j {
+		return []string{}
+	}
+	return values[i : j+1]
+}
+
+// globMatch reports whether the glob-style pattern of SCAN matches the whole
+// value. It supports *, ? and escapes with \.
+func globMatch(pattern, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if globMatch(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(value) == 0 {
+				return false
+			}
+			pattern, value = pattern[1:], value[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if len(value) == 0 || pattern[0] != value[0] {
+			return false
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return len(value) == 0
+}
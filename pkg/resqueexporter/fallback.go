@@ -0,0 +1,111 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	redisFallbackURLs = newStringsValue()
+)
+
+func init() {
+	Flags.Var(redisFallbackURLs, "redis.fallback-url", "URL to the Redis to fail over to when the connection to the current one fails. Can be repeated to fail over in the given order.")
+}
+
+var (
+	redisEndpointDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis", "endpoint_info"),
+		"Redis the metrics are collected from, labeled with its URL without the credentials.",
+		[]string{"url"}, nil,
+	)
+)
+
+// endpoints keeps track of the Redis the metrics are collected from, among
+// the Redis to fail over to in order.
+type endpoints struct {
+	clients []redis.UniversalClient
+	urls    []string
+
+	// shared is true if the client is given by the program embedding the
+	// collector, which is responsible for closing it.
+	shared bool
+
+	mu      sync.Mutex
+	current int
+	// warming are the clients whose pools are being warmed.
+	warming map[redis.UniversalClient]bool
+}
+
+func newEndpoints(redisURLs []string) (*endpoints, error) {
+	e := &endpoints{}
+	for _, redisURL := range redisURLs {
+		client, err := newRedisClient(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		instrumentClient(client)
+		e.clients = append(e.clients, client)
+		e.urls = append(e.urls, redactedURL(redisURL).String())
+	}
+	return e, nil
+}
+
+// newClientEndpoints returns the endpoints of the Redis of the given client,
+// without failing over to other Redis.
+func newClientEndpoints(client redis.UniversalClient) *endpoints {
+	return &endpoints{
+		clients: []redis.UniversalClient{client},
+		urls:    []string{clientURL(client)},
+		shared:  true,
+	}
+}
+
+// clientURL returns the URL of the Redis of the client, or an empty string if
+// it is not known.
+func clientURL(client redis.UniversalClient) string {
+	switch c := client.(type) {
+	case *redis.Client:
+		return fmt.Sprintf("redis://%s/%d", c.Options().Addr, c.Options().DB)
+	case *redis.ClusterClient:
+		return "redis+cluster://" + strings.Join(c.Options().Addrs, ",")
+	}
+	return ""
+}
+
+// get returns the client of the current Redis and its URL.
+func (e *endpoints) get() (redis.UniversalClient, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.clients[e.current], e.urls[e.current]
+}
+
+// failover moves on to the next Redis after the connection to the client
+// failed, unless another scrape already did.
+func (e *endpoints) failover(client redis.UniversalClient) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.clients) == 1 || e.clients[e.current] != client {
+		return
+	}
+	from := e.urls[e.current]
+	e.current = (e.current + 1) % len(e.clients)
+	log.Warnf("Failing over from Redis %s to %s", from, e.urls[e.current])
+}
+
+// close closes the clients of all the Redis, unless they are shared.
+func (e *endpoints) close() {
+	if e.shared {
+		return
+	}
+	for _, client := range e.clients {
+		client.Close()
+	}
+}
@@ -0,0 +1,100 @@
+package resqueexporter
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	graphiteAddress = Flags.String(
+		"graphite.address",
+		"",
+		"Address of the Graphite server to send the metrics to in the plaintext protocol at the interval, in addition to serving them over HTTP.",
+	)
+	graphiteInterval = Flags.Duration(
+		"graphite.interval",
+		time.Minute,
+		"Interval to send the metrics to the Graphite server at.",
+	)
+	graphitePrefix = Flags.String(
+		"graphite.prefix",
+		"",
+		"Prefix of the paths of the metrics sent to the Graphite server.",
+	)
+)
+
+// graphiteSink sends the metrics to a Graphite server. The values of the
+// labels are appended to the paths of the metrics.
+type graphiteSink struct {
+	address string
+}
+
+// String implements sink.
+func (g *graphiteSink) String() string {
+	return "graphite://" + g.address
+}
+
+// push implements sink.
+func (g *graphiteSink) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", g.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	for _, s := range samples(mfs, time.Now()) {
+		w.WriteString(g.path(s))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(s.value, 'f', -1, 64))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatInt(s.timestamp/1000, 10))
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// path returns the path of the sample in Graphite.
+func (g *graphiteSink) path(s sample) string {
+	path := s.name
+	if *graphitePrefix != "" {
+		path = *graphitePrefix + "." + path
+	}
+	for _, l := range s.labels {
+		path += "." + graphiteSanitize(l.value)
+	}
+	return path
+}
+
+// graphiteSanitize replaces the characters separating the nodes of the paths,
+// and the ones separating the fields of the plaintext protocol, with
+// underscores.
+func graphiteSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// startGraphite starts sending the metrics of the targets to the Graphite
+// server given by --graphite.address until the context is done.
+func startGraphite(ctx context.Context, r *reloader) error {
+	if _, _, err := net.SplitHostPort(*graphiteAddress); err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, &graphiteSink{address: *graphiteAddress}, *graphiteInterval)
+	return nil
+}
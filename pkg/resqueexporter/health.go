@@ -0,0 +1,74 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	readyMaxScrapeAge = Flags.Duration(
+		"web.ready-max-scrape-age",
+		0,
+		"Maximum time since the last scrape for /-/ready to report ready, e.g. to detect wedged scrapes. 0 disables the check.",
+	)
+)
+
+// healthy reports that the exporter is alive.
+func healthy(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "Healthy")
+}
+
+// ready reports whether the Redis of all the targets are reachable, and the
+// last scrape was finished recently enough.
+func (r *reloader) ready(w http.ResponseWriter, req *http.Request) {
+	if err := r.checkReady(req.Context()); err != nil {
+		log.Debugf("Not ready: %s", err)
+		http.Error(w, fmt.Sprintf("Not ready: %s", err), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "Ready")
+}
+
+func (r *reloader) checkReady(ctx context.Context) error {
+	if *readyMaxScrapeAge > 0 {
+		r.lastCollectMu.Lock()
+		age := time.Since(r.lastCollect)
+		r.lastCollectMu.Unlock()
+		if age > *readyMaxScrapeAge {
+			return fmt.Errorf("no scrapes for %s", age)
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i, exporter := range r.exporters {
+		client, _ := exporter.redisEndpoints.get()
+		if err := contextClient(ctx, client).Ping().Err(); err != nil {
+			return fmt.Errorf("%s: %s", redactedURL(r.targets[i].URL), err)
+		}
+	}
+	return nil
+}
+
+// quitHandler requests the exporter to shut down on POST requests.
+func quitHandler(quit chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprintln(w, "Requesting termination... Goodbye!")
+		select {
+		case quit <- struct{}{}:
+		default:
+			// The shutdown has already been requested.
+		}
+	})
+}
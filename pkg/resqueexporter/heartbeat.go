@@ -0,0 +1,112 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pruneInterval is the default age of the last heartbeat after which Resque 2
+// considers a worker dead (Resque.prune_interval).
+const pruneInterval = 5 * time.Minute
+
+var (
+	resqueVersion = Flags.String(
+		"resque.version",
+		"auto",
+		"Major version of Resque (1 or 2), or auto to detect it from the Redis keys.",
+	)
+)
+
+var (
+	deadWorkersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dead_workers"),
+		"Number of workers whose heartbeat or ping has expired.",
+		nil, nil,
+	)
+)
+
+// usesHeartbeats reports whether the workers record heartbeats in the
+// workers:heartbeat hash, as Resque 2 does.
+func (e *Collector) usesHeartbeats() (bool, error) {
+	switch *resqueVersion {
+	case "1":
+		return false, nil
+	case "2":
+		return true, nil
+	case "auto":
+		exists, err := e.redisClient.Exists(e.redisKey("workers", "heartbeat")).Result()
+		if err != nil {
+			return false, err
+		}
+		return exists == 1, nil
+	default:
+		return false, fmt.Errorf("unknown Resque version: %s", *resqueVersion)
+	}
+}
+
+// deadWorkers returns the workers known to be dead, or nil if the workers
+// record neither heartbeats nor pings.
+func (e *Collector) deadWorkers(workers []string) (map[string]bool, error) {
+	heartbeats, err := e.usesHeartbeats()
+	if err != nil {
+		return nil, err
+	}
+	pings := compatEnabled("node")
+	if !heartbeats && !pings {
+		return nil, nil
+	}
+
+	// Heartbeats and pings are recorded using the clock of the Redis server.
+	now, err := e.redisClient.Time().Result()
+	if err != nil {
+		return nil, err
+	}
+
+	dead := make(map[string]bool)
+	if heartbeats {
+		if err := e.expiredHeartbeats(now, workers, dead); err != nil {
+			return nil, err
+		}
+	}
+	if pings {
+		if err := e.expiredPings(now, workers, dead); err != nil {
+			return nil, err
+		}
+	}
+	return dead, nil
+}
+
+// expiredHeartbeats adds the workers whose heartbeat is older than the prune
+// interval to dead. Resque 2 leaves such workers in the set of workers until
+// another worker prunes them, so they have to be excluded from the live
+// workers. The heartbeats of the workers missing from the set of workers,
+// e.g. left behind by a worker that unregistered, are ignored, and the ones
+// that can't be parsed are skipped.
+func (e *Collector) expiredHeartbeats(now time.Time, workers []string, dead map[string]bool) error {
+	key := e.redisKey("workers", "heartbeat")
+	heartbeats, err := e.redisClient.HGetAll(key).Result()
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]bool, len(workers))
+	for _, worker := range workers {
+		registered[worker] = true
+	}
+	for worker, heartbeat := range heartbeats {
+		if !registered[worker] {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, heartbeat)
+		if err != nil {
+			e.skipKey(key+" "+worker, skipInvalidValue, err)
+			continue
+		}
+		if now.Sub(t) > pruneInterval {
+			dead[worker] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package resqueexporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectorDeadWorkers(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	expired := time.Now().Add(-2 * pruneInterval).Format(time.RFC3339)
+	r.hset("resque:workers:heartbeat", "host:1:default", expired)
+	r.hset("resque:workers:heartbeat", "host:2:mailers", "not a time")
+	// The heartbeat of a worker missing from the set of workers.
+	r.hset("resque:workers:heartbeat", "host:3:low", expired)
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "workers"}, 1)
+	assertSample(t, mfs, "resque_dead_workers", nil, 1)
+	assertSample(t, mfs, "resque_workers", nil, 1)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "invalid_value"}, 1)
+}
@@ -0,0 +1,184 @@
+package resqueexporter
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// setFlags sets the flags for the test, and restores them when it finishes.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+
+	for name, value := range values {
+		f := Flags.Lookup(name)
+		if f == nil {
+			t.Fatalf("unknown flag: %s", name)
+		}
+		// The repeated flags accumulate their values, so they are
+		// restored by copying them.
+		if v, ok := f.Value.(*stringsValue); ok {
+			saved := *v
+			t.Cleanup(func() { *v = saved })
+		} else {
+			saved := f.Value.String()
+			t.Cleanup(func() { f.Value.Set(saved) })
+		}
+		if err := f.Value.Set(value); err != nil {
+			t.Fatalf("invalid value %q for %s: %s", value, name, err)
+		}
+	}
+}
+
+// restoreFlags restores all the flags when the test finishes, e.g. after they
+// are set by a configuration file.
+func restoreFlags(t *testing.T) {
+	values := make(map[string]string)
+	Flags.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*stringsValue); !ok {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	t.Cleanup(func() {
+		for name, value := range values {
+			Flags.Set(name, value)
+		}
+	})
+}
+
+// gather registers the collector to a new registry and gathers its metrics,
+// failing the test on errors, e.g. of inconsistent label dimensions.
+func gather(t *testing.T, c prometheus.Collector) []*dto.MetricFamily {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs
+}
+
+// seriesValue returns the value of the series of the metric having the labels,
+// which is the sample count of a summary or a histogram, and whether there is
+// exactly one such series.
+func seriesValue(mfs []*dto.MetricFamily, name string, labels map[string]string) (float64, bool) {
+	m, ok := findSeries(mfs, name, labels)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue(), true
+	case m.Counter != nil:
+		return m.Counter.GetValue(), true
+	case m.Untyped != nil:
+		return m.Untyped.GetValue(), true
+	case m.Summary != nil:
+		return float64(m.Summary.GetSampleCount()), true
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount()), true
+	}
+	return 0, true
+}
+
+// findSeries returns the series of the metric having the labels, and whether
+// there is exactly one such series.
+func findSeries(mfs []*dto.MetricFamily, name string, labels map[string]string) (*dto.Metric, bool) {
+	var (
+		series *dto.Metric
+		n      int
+	)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range mf.Metric {
+			for lname, lvalue := range labels {
+				found := false
+				for _, l := range m.Label {
+					if l.GetName() == lname && l.GetValue() == lvalue {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue series
+				}
+			}
+			series = m
+			n++
+		}
+	}
+	return series, n == 1
+}
+
+// assertSample fails the test unless the series of the metric having the
+// labels has the value.
+func assertSample(t *testing.T, mfs []*dto.MetricFamily, name string, labels map[string]string, want float64) {
+	t.Helper()
+
+	got, ok := seriesValue(mfs, name, labels)
+	if !ok {
+		t.Errorf("%s%v: no single series", name, labels)
+		return
+	}
+	if got != want {
+		t.Errorf("%s%v = %v, want %v", name, labels, got, want)
+	}
+}
+
+// assertSummarySum fails the test unless the series of the summary having the
+// labels has the sum.
+func assertSummarySum(t *testing.T, mfs []*dto.MetricFamily, name string, labels map[string]string, want float64) {
+	t.Helper()
+
+	m, ok := findSeries(mfs, name, labels)
+	if !ok || m.Summary == nil {
+		t.Errorf("%s%v: no single summary", name, labels)
+		return
+	}
+	if got := m.Summary.GetSampleSum(); got != want {
+		t.Errorf("%s%v sum = %v, want %v", name, labels, got, want)
+	}
+}
+
+// assertNoSample fails the test if the metric has a series having the labels.
+func assertNoSample(t *testing.T, mfs []*dto.MetricFamily, name string, labels map[string]string) {
+	t.Helper()
+
+	if _, ok := seriesValue(mfs, name, labels); ok {
+		t.Errorf("%s%v: unexpected series", name, labels)
+	}
+}
+
+// seedResque seeds the fake Redis with the keys of a Resque in the resque
+// namespace: two queues, a failed queue and two workers, one of which is
+// working a job.
+func seedResque(r *fakeRedis) {
+	r.set("resque:stat:processed", "10")
+	r.set("resque:stat:failed", "2")
+	r.sadd("resque:queues", "default", "mailers")
+	r.rpush("resque:queue:default", `{"class":"A","args":[]}`, `{"class":"A","args":[]}`, `{"class":"B","args":[]}`)
+	r.rpush("resque:failed", `{"failed_at":"2020-01-01","payload":{"class":"A","args":[]},"queue":"default"}`, `{"failed_at":"2020-01-02","payload":{"class":"B","args":[]},"queue":"default"}`)
+	r.sadd("resque:workers", "host:1:default", "host:2:mailers")
+	r.set("resque:worker:host:1:default", `{"queue":"default","run_at":"2020-01-01","payload":{"class":"A","args":[]}}`)
+}
+
+// newTestCollector returns a collector of the fake Redis.
+func newTestCollector(t *testing.T, r *fakeRedis, opts ...Option) *Collector {
+	t.Helper()
+
+	c, err := NewCollector(append([]Option{WithRedisURL(r.url())}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
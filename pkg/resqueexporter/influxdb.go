@@ -0,0 +1,179 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	influxDBURL = Flags.String(
+		"influxdb.url",
+		"",
+		"URL of the InfluxDB write endpoint, e.g. http://localhost:8086/write?db=resque, or udp://host:port of the UDP listener, to write the metrics to in the line protocol at the interval, in addition to serving them over HTTP.",
+	)
+	influxDBInterval = Flags.Duration(
+		"influxdb.interval",
+		time.Minute,
+		"Interval to write the metrics to InfluxDB at.",
+	)
+)
+
+// influxDBMaxPacketSize is the maximum size of the UDP packets sent to
+// InfluxDB, which fits in the MTU of the Ethernet.
+const influxDBMaxPacketSize = 1432
+
+// influxDBSink writes the metrics to InfluxDB in the line protocol. The names
+// of the metrics are the measurements, and their labels, like the queues and
+// the workers, are the tags. The values are written in the value field.
+type influxDBSink struct {
+	url    string
+	client *http.Client
+	// conn is the connection to the UDP listener, or nil if the metrics are
+	// written over HTTP.
+	conn net.Conn
+}
+
+// newInfluxDBSink returns an InfluxDB sink writing to the URL.
+func newInfluxDBSink(rawurl string) (*influxDBSink, error) {
+	u, err := parseURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	s := &influxDBSink{url: rawurl}
+	switch u.Scheme {
+	case "http", "https":
+		s.client = &http.Client{Timeout: *influxDBInterval}
+	case "udp":
+		if s.conn, err = net.Dial("udp", u.Host); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme of InfluxDB URL: %s", u.Scheme)
+	}
+	return s, nil
+}
+
+// String implements sink.
+func (s *influxDBSink) String() string {
+	return redactURL(s.url)
+}
+
+// push implements sink.
+func (s *influxDBSink) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var lines [][]byte
+	for _, sample := range samples(mfs, time.Now()) {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			// The line protocol can't represent them.
+			continue
+		}
+		lines = append(lines, influxDBLine(sample))
+	}
+	if s.conn != nil {
+		return s.writeUDP(lines)
+	}
+	return s.writeHTTP(ctx, bytes.Join(lines, nil))
+}
+
+func (s *influxDBSink) writeHTTP(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "resque_exporter/"+version.Version)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func (s *influxDBSink) writeUDP(lines [][]byte) error {
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line) > influxDBMaxPacketSize {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// influxDBLine returns the sample in the line protocol with the timestamp in
+// nanoseconds. The labels of empty values are omitted, since the line
+// protocol doesn't allow empty tag values.
+func influxDBLine(s sample) []byte {
+	var b bytes.Buffer
+	b.WriteString(influxDBEscape(s.name, ", "))
+	for _, l := range s.labels {
+		if l.value == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(influxDBEscape(l.name, ",= "))
+		b.WriteByte('=')
+		b.WriteString(influxDBEscape(l.value, ",= "))
+	}
+	b.WriteString(" value=")
+	b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(s.timestamp*int64(time.Millisecond), 10))
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// influxDBEscape escapes the given special characters of the line protocol
+// with backslashes. The newlines, which can't be escaped, are replaced with
+// spaces.
+func influxDBEscape(s, special string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if r == '\n' {
+			r = ' '
+		}
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// startInfluxDB starts writing the metrics of the targets to InfluxDB at the
+// URL given by --influxdb.url until the context is done.
+func startInfluxDB(ctx context.Context, r *reloader) error {
+	s, err := newInfluxDBSink(*influxDBURL)
+	if err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, s, *influxDBInterval)
+	return nil
+}
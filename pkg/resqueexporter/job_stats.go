@@ -0,0 +1,137 @@
+package resqueexporter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobStatsAverageDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job_stats", "average_duration_seconds"),
+		"Average duration of the recent executions of a job class.",
+		[]string{"class"}, nil,
+	)
+	jobStatsEnqueuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job_stats", "enqueued_total"),
+		"Total number of enqueued jobs of a job class.",
+		[]string{"class"}, nil,
+	)
+	jobStatsFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job_stats", "failed_total"),
+		"Total number of failed jobs of a job class.",
+		[]string{"class"}, nil,
+	)
+	jobStatsPerformedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "job_stats", "performed_total"),
+		"Total number of performed jobs of a job class.",
+		[]string{"class"}, nil,
+	)
+)
+
+var jobStatsCounterDescs = map[string]*prometheus.Desc{
+	"enqueued":  jobStatsEnqueuedDesc,
+	"failed":    jobStatsFailedDesc,
+	"performed": jobStatsPerformedDesc,
+}
+
+func init() {
+	registerCollector("job-stats", false, "Collect per-class job statistics recorded by resque-job-stats.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeJobStats(ch)
+	})
+}
+
+func (e *Collector) scrapeJobStats(ch chan<- prometheus.Metric) error {
+	pattern := e.redisKeyPattern("stats", "jobs", "*")
+
+	// Keys look like stats:jobs:<class>:<stat>. Class names may contain
+	// colons (e.g. Foo::BarJob), so the stat is taken from the end.
+	stats := make(map[string]map[string]string)
+	err := e.scanKeys(pattern.String(), func(key string) error {
+		name, ok := pattern.Match(key)
+		if !ok {
+			return nil
+		}
+		i := strings.LastIndex(name, *redisKeySeparator)
+		if i <= 0 {
+			return nil
+		}
+		class, stat := name[:i], name[i+len(*redisKeySeparator):]
+		if _, ok := jobStatsCounterDescs[stat]; !ok && stat != "duration" {
+			return nil
+		}
+		if stats[class] == nil {
+			stats[class] = make(map[string]string)
+		}
+		stats[class][stat] = key
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	classes := make([]string, 0, len(stats))
+	for class := range stats {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	for _, class := range classes {
+		for stat, key := range stats[class] {
+			if stat == "duration" {
+				durations, err := e.redisClient.LRange(key, 0, -1).Result()
+				if isWrongTypeError(err) {
+					e.skipKey(key, skipWrongType, err)
+					continue
+				} else if err != nil {
+					return err
+				}
+				if len(durations) == 0 {
+					continue
+				}
+				sum, err := sumDurations(durations)
+				if err != nil {
+					e.skipKey(key, skipInvalidValue, err)
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(jobStatsAverageDurationDesc, prometheus.GaugeValue, sum/float64(len(durations)), class)
+				continue
+			}
+
+			value, err := e.redisClient.Get(key).Result()
+			if err == redis.Nil {
+				// The key is deleted since it is scanned.
+				continue
+			} else if isWrongTypeError(err) {
+				e.skipKey(key, skipWrongType, err)
+				continue
+			} else if err != nil {
+				return err
+			}
+			count, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				e.skipKey(key, skipInvalidValue, err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(jobStatsCounterDescs[stat], prometheus.CounterValue, count, class)
+		}
+	}
+
+	return nil
+}
+
+// sumDurations returns the sum of the durations recorded by resque-job-stats.
+func sumDurations(durations []string) (float64, error) {
+	var sum float64
+	for _, d := range durations {
+		v, err := strconv.ParseFloat(d, 64)
+		if err != nil {
+			return 0, err
+		}
+		sum += v
+	}
+	return sum, nil
+}
@@ -0,0 +1,24 @@
+package resqueexporter
+
+import (
+	"testing"
+)
+
+func TestCollectorJobStatsSkipsInvalidValues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("resque:stats:jobs:A:performed", "3")
+	r.set("resque:stats:jobs:B:performed", "not a number")
+	r.rpush("resque:stats:jobs:A:duration", "1", "2")
+	r.rpush("resque:stats:jobs:B:duration", "1", "oops")
+	setFlags(t, map[string]string{"collector.job-stats": "true"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "job-stats"}, 1)
+	assertSample(t, mfs, "resque_job_stats_performed_total", map[string]string{"class": "A"}, 3)
+	assertNoSample(t, mfs, "resque_job_stats_performed_total", map[string]string{"class": "B"})
+	assertSample(t, mfs, "resque_job_stats_average_duration_seconds", map[string]string{"class": "A"}, 1.5)
+	assertNoSample(t, mfs, "resque_job_stats_average_duration_seconds", map[string]string{"class": "B"})
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "invalid_value"}, 2)
+}
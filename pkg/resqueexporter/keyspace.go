@@ -0,0 +1,173 @@
+package resqueexporter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	jobsEnqueuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_enqueued_total"),
+		"Total number of jobs enqueued to a queue since the exporter subscribed to the keyspace notifications.",
+		[]string{"queue"}, nil,
+	)
+	jobsDequeuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_dequeued_total"),
+		"Total number of jobs dequeued from a queue since the exporter subscribed to the keyspace notifications.",
+		[]string{"queue"}, nil,
+	)
+)
+
+// keyspaceEvents are the events of the keyspace notifications of the lists
+// counted as enqueuing, or dequeuing if false, a job. Resque pushes the jobs to
+// the tail of the queues and pops them from the head, but the plugins may push
+// them to the head.
+var keyspaceEvents = map[string]bool{
+	"rpush":   true,
+	"lpush":   true,
+	"linsert": true,
+	"lpop":    false,
+	"rpop":    false,
+}
+
+var errKeyspaceNotificationsCluster = errors.New("keyspace notifications are not supported with Redis Cluster")
+
+// queueCounts is the numbers of the jobs enqueued to and dequeued from a
+// queue.
+type queueCounts struct {
+	enqueued, dequeued float64
+}
+
+// keyspaceTracker counts the jobs enqueued to and dequeued from the queues of
+// each namespace by subscribing to the keyspace notifications of the queues.
+type keyspaceTracker struct {
+	mu         sync.Mutex
+	closed     bool
+	namespaces map[string]*keyspaceSubscription
+}
+
+type keyspaceSubscription struct {
+	pubsub *redis.PubSub
+	counts map[string]*queueCounts
+}
+
+func init() {
+	registerCollector("keyspace-notifications", false, "Count the jobs enqueued to and dequeued from the queues by subscribing to the keyspace notifications of Redis, which need notify-keyspace-events to include K and l. The jobs are counted from the first scrape.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeKeyspaceNotifications(ch, s.filter)
+	})
+}
+
+func newKeyspaceTracker() *keyspaceTracker {
+	return &keyspaceTracker{namespaces: make(map[string]*keyspaceSubscription)}
+}
+
+// counts returns the numbers of the jobs of the queues matching the pattern
+// counted so far, subscribing to the keyspace notifications of the queues of
+// the namespace with the client on the first call.
+func (t *keyspaceTracker) counts(client redis.UniversalClient, namespace string, pattern keyPattern) (map[string]queueCounts, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.namespaces[namespace]
+	if !ok {
+		if t.closed {
+			return nil, nil
+		}
+		c, ok := client.(*redis.Client)
+		if !ok {
+			return nil, errKeyspaceNotificationsCluster
+		}
+		checkKeyspaceNotifications(c)
+
+		prefix := "__keyspace@" + strconv.Itoa(c.Options().DB) + "__:"
+		s = &keyspaceSubscription{
+			pubsub: c.PSubscribe(prefix + pattern.String()),
+			counts: make(map[string]*queueCounts),
+		}
+		t.namespaces[namespace] = s
+		go t.receive(s, prefix, pattern)
+	}
+
+	counts := make(map[string]queueCounts, len(s.counts))
+	for queue, c := range s.counts {
+		counts[queue] = *c
+	}
+	return counts, nil
+}
+
+// receive counts the jobs of the notifications of the subscription until it is
+// closed.
+func (t *keyspaceTracker) receive(s *keyspaceSubscription, prefix string, pattern keyPattern) {
+	for msg := range s.pubsub.Channel() {
+		enqueued, ok := keyspaceEvents[msg.Payload]
+		if !ok {
+			continue
+		}
+		queue, ok := pattern.Match(strings.TrimPrefix(msg.Channel, prefix))
+		if !ok {
+			continue
+		}
+
+		t.mu.Lock()
+		c, ok := s.counts[queue]
+		if !ok {
+			c = &queueCounts{}
+			s.counts[queue] = c
+		}
+		if enqueued {
+			c.enqueued++
+		} else {
+			c.dequeued++
+		}
+		t.mu.Unlock()
+	}
+}
+
+// close unsubscribes from the keyspace notifications.
+func (t *keyspaceTracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for _, s := range t.namespaces {
+		s.pubsub.Close()
+	}
+}
+
+// checkKeyspaceNotifications warns if the keyspace notifications of the lists
+// are not enabled. The configuration is not checked if CONFIG is not
+// available, e.g. on managed Redis.
+func checkKeyspaceNotifications(client *redis.Client) {
+	config, err := client.ConfigGet("notify-keyspace-events").Result()
+	if err != nil || len(config) != 2 {
+		return
+	}
+	events, _ := config[1].(string)
+	if !strings.Contains(events, "K") || !strings.ContainsAny(events, "lA") {
+		log.Warnf("The keyspace notifications of the lists are not enabled: notify-keyspace-events is %q", events)
+	}
+}
+
+func (e *Collector) scrapeKeyspaceNotifications(ch chan<- prometheus.Metric, filter *queueFilter) error {
+	client, _ := e.redisEndpoints.get()
+	counts, err := e.keyspace.counts(client, e.redisNamespace, e.redisKeyPattern("queue", "*"))
+	if err != nil {
+		return err
+	}
+
+	for queue, c := range counts {
+		if !filter.match(queue) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(jobsEnqueuedDesc, prometheus.CounterValue, c.enqueued, queue)
+		ch <- prometheus.MustNewConstMetric(jobsDequeuedDesc, prometheus.CounterValue, c.dequeued, queue)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package resqueexporter
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// reservedLabelNames are the names of the labels of the metrics of the
+// exporter, including the ones added to them like target and namespace. The
+// labels added to the metrics, e.g. of a target, can't have these names, as
+// labeledMetric doesn't check for duplicate label names.
+var reservedLabelNames = map[string]bool{
+	"app":               true,
+	"class":             true,
+	"collector":         true,
+	"command":           true,
+	"namespace":         true,
+	"pattern":           true,
+	"queue":             true,
+	"reason":            true,
+	"target":            true,
+	"url":               true,
+	model.BucketLabel:   true,
+	model.QuantileLabel: true,
+}
+
+// labeledMetric is a metric with additional constant labels. The labels are
+// not part of its Desc, so it must not be gathered by a pedantic registry.
+type labeledMetric struct {
+	prometheus.Metric
+	labels []*dto.LabelPair
+}
+
+// Write implements prometheus.Metric.
+func (m labeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.Label = append(out.Label, m.labels...)
+	sort.Sort(prometheus.LabelPairSorter(out.Label))
+	return nil
+}
+
+// withLabels returns a channel forwarding the metrics sent to it to ch with
+// the given labels added. The returned function must be called once all the
+// metrics are sent, and returns after they are forwarded.
+func withLabels(ch chan<- prometheus.Metric, labels prometheus.Labels) (chan<- prometheus.Metric, func()) {
+	labelPairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		labelPairs = append(labelPairs, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+
+	labeledCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range labeledCh {
+			ch <- labeledMetric{Metric: m, labels: labelPairs}
+		}
+		close(done)
+	}()
+
+	return labeledCh, func() {
+		close(labeledCh)
+		<-done
+	}
+}
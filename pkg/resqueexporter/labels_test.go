@@ -0,0 +1,268 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var testQueueDesc = prometheus.NewDesc("test_jobs", "Number of jobs.", []string{"queue"}, nil)
+
+// metricsCollector collects the metrics, e.g. the ones forwarded by a label
+// pipeline.
+type metricsCollector []prometheus.Metric
+
+// Describe implements prometheus.Collector.
+func (c metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	seen := make(map[*prometheus.Desc]bool)
+	for _, m := range c {
+		if !seen[m.Desc()] {
+			seen[m.Desc()] = true
+			ch <- m.Desc()
+		}
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c {
+		ch <- m
+	}
+}
+
+// pipe returns the metrics of the queues sent through the pipeline of a label
+// filter like withLabels, which returns the channel to send them to.
+func pipe(queues map[string]float64, filter func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func())) metricsCollector {
+	return collectMetrics(func(ch chan<- prometheus.Metric) {
+		filteredCh, done := filter(ch)
+		for queue, jobs := range queues {
+			filteredCh <- prometheus.MustNewConstMetric(testQueueDesc, prometheus.GaugeValue, jobs, queue)
+		}
+		done()
+	})
+}
+
+func TestWithLabels(t *testing.T) {
+	metrics := pipe(map[string]float64{"a": 1, "b": 2}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		return withLabels(ch, prometheus.Labels{"target": "redis://localhost:6379"})
+	})
+
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "a", "target": "redis://localhost:6379"}, 1)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "b", "target": "redis://localhost:6379"}, 2)
+}
+
+func TestRewriteLabels(t *testing.T) {
+	rules, err := newRewriteRules([]rewriteConfig{
+		{Match: `mailer_shard_\d+`, Replacement: "mailer_shard"},
+		{Match: `(.+)_\d{8}`, Replacement: "${1}_date"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := pipe(map[string]float64{
+		"mailer_shard_1":   1,
+		"mailer_shard_2":   2,
+		"export_20200101":  4,
+		"default":          8,
+		"mailer_shard_1_x": 16,
+	}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		return rewriteLabels(ch, rules)
+	})
+
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "mailer_shard"}, 3)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "export_date"}, 4)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "default"}, 8)
+	// The rules match whole names only.
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "mailer_shard_1_x"}, 16)
+}
+
+func TestRewriteLabelsSummaries(t *testing.T) {
+	rules, err := newRewriteRules([]rewriteConfig{{Match: `mailer_shard_\d+`, Replacement: "mailer_shard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := prometheus.NewDesc("test_job_duration_seconds", "Duration of jobs.", []string{"queue"}, nil)
+	metrics := collectMetrics(func(ch chan<- prometheus.Metric) {
+		rewrittenCh, done := rewriteLabels(ch, rules)
+		rewrittenCh <- prometheus.MustNewConstSummary(desc, 1, 2, nil, "mailer_shard_1")
+		rewrittenCh <- prometheus.MustNewConstSummary(desc, 3, 4, nil, "mailer_shard_2")
+		rewrittenCh <- prometheus.MustNewConstSummary(desc, 5, 6, nil, "default")
+		done()
+	})
+
+	mfs := gather(t, metricsCollector(metrics))
+	assertSample(t, mfs, "test_job_duration_seconds", map[string]string{"queue": "mailer_shard"}, 4)
+	assertSummarySum(t, mfs, "test_job_duration_seconds", map[string]string{"queue": "mailer_shard"}, 6)
+	assertSample(t, mfs, "test_job_duration_seconds", map[string]string{"queue": "default"}, 5)
+	assertNoSample(t, mfs, "test_job_duration_seconds", map[string]string{"queue": "mailer_shard_1"})
+}
+
+func TestLimitLabels(t *testing.T) {
+	var truncated int
+	metrics := pipe(map[string]float64{"a": 1, "b": 2, "c": 4, "d": 8}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		limitedCh, done := limitLabels(ch, 2)
+		return limitedCh, func() { truncated = done() }
+	})
+
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "a"}, 1)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "b"}, 2)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": otherLabelValue}, 12)
+	assertNoSample(t, mfs, "test_jobs", map[string]string{"queue": "c"})
+	if truncated != 2 {
+		t.Errorf("truncated = %d, want 2", truncated)
+	}
+}
+
+func TestLimitLabelsSummaries(t *testing.T) {
+	desc := prometheus.NewDesc("test_job_duration_seconds", "Duration of jobs.", []string{"class"}, nil)
+	var truncated int
+	metrics := collectMetrics(func(ch chan<- prometheus.Metric) {
+		limitedCh, done := limitLabels(ch, 1)
+		limitedCh <- prometheus.MustNewConstSummary(desc, 1, 2, nil, "A")
+		limitedCh <- prometheus.MustNewConstSummary(desc, 3, 4, nil, "B")
+		limitedCh <- prometheus.MustNewConstSummary(desc, 5, 6, nil, "C")
+		truncated = done()
+	})
+
+	mfs := gather(t, metricsCollector(metrics))
+	assertSample(t, mfs, "test_job_duration_seconds", map[string]string{"class": "A"}, 1)
+	assertSummarySum(t, mfs, "test_job_duration_seconds", map[string]string{"class": "A"}, 2)
+	assertSample(t, mfs, "test_job_duration_seconds", map[string]string{"class": otherLabelValue}, 8)
+	assertSummarySum(t, mfs, "test_job_duration_seconds", map[string]string{"class": otherLabelValue}, 10)
+	assertNoSample(t, mfs, "test_job_duration_seconds", map[string]string{"class": "B"})
+	if truncated != 2 {
+		t.Errorf("truncated = %d, want 2", truncated)
+	}
+}
+
+func TestLimitLabelsHistograms(t *testing.T) {
+	desc := prometheus.NewDesc("test_job_duration_seconds", "Duration of jobs.", []string{"queue"}, nil)
+	metrics := collectMetrics(func(ch chan<- prometheus.Metric) {
+		limitedCh, done := limitLabels(ch, 1)
+		limitedCh <- prometheus.MustNewConstHistogram(desc, 1, 1, map[float64]uint64{1: 1, 10: 1}, "a")
+		limitedCh <- prometheus.MustNewConstHistogram(desc, 2, 3, map[float64]uint64{1: 1, 10: 2}, "b")
+		limitedCh <- prometheus.MustNewConstHistogram(desc, 4, 30, map[float64]uint64{1: 0, 10: 3}, "c")
+		done()
+	})
+
+	mfs := gather(t, metricsCollector(metrics))
+	assertSample(t, mfs, "test_job_duration_seconds", map[string]string{"queue": "a"}, 1)
+	m, ok := findSeries(mfs, "test_job_duration_seconds", map[string]string{"queue": otherLabelValue})
+	if !ok || m.Histogram == nil {
+		t.Fatal("no single histogram summing the other queues")
+	}
+	if got := m.Histogram.GetSampleCount(); got != 6 {
+		t.Errorf("count = %d, want 6", got)
+	}
+	if got := m.Histogram.GetSampleSum(); got != 33 {
+		t.Errorf("sum = %v, want 33", got)
+	}
+	var buckets []string
+	for _, b := range m.Histogram.Bucket {
+		buckets = append(buckets, fmt.Sprintf("%v:%d", b.GetUpperBound(), b.GetCumulativeCount()))
+	}
+	if got, want := strings.Join(buckets, " "), "1:1 10:5"; got != want {
+		t.Errorf("buckets = %s, want %s", got, want)
+	}
+}
+
+func TestLimitLabelsUnderLimit(t *testing.T) {
+	metrics := pipe(map[string]float64{"a": 1, "b": 2}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		limitedCh, done := limitLabels(ch, 2)
+		return limitedCh, func() { done() }
+	})
+
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "a"}, 1)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "b"}, 2)
+	assertNoSample(t, mfs, "test_jobs", map[string]string{"queue": otherLabelValue})
+}
+
+func TestSanitizeLabels(t *testing.T) {
+	var sanitized int
+	metrics := pipe(map[string]float64{"default": 1, "bad\xff": 2, "new\nline": 4}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		sanitizedCh, done := sanitizeLabels(ch)
+		return sanitizedCh, func() { sanitized = done() }
+	})
+
+	// The family mixes the sanitized and the clean series, which must have
+	// the same label dimensions to be gathered.
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": "default"}, 1)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": `bad\xff`}, 2)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": `new\x0aline`}, 4)
+	if sanitized != 2 {
+		t.Errorf("sanitized = %d, want 2", sanitized)
+	}
+}
+
+func TestSanitizeLabelsEscapedCollision(t *testing.T) {
+	// The name spelling the escape of an invalid byte doesn't collide with
+	// the escaped name.
+	metrics := pipe(map[string]float64{`a\xff`: 1, "a\xff": 2}, func(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+		sanitizedCh, done := sanitizeLabels(ch)
+		return sanitizedCh, func() { done() }
+	})
+
+	mfs := gather(t, metrics)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": `a\\xff`}, 1)
+	assertSample(t, mfs, "test_jobs", map[string]string{"queue": `a\xff`}, 2)
+}
+
+func TestReservedLabelNames(t *testing.T) {
+	r := newFakeRedis(t)
+	c := newTestCollector(t, r)
+
+	// The labels of all the metrics of the exporter are reserved.
+	variableLabels := regexp.MustCompile(`variableLabels: \[(.*)\]}$`)
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		m := variableLabels.FindStringSubmatch(desc.String())
+		if m == nil {
+			t.Fatalf("unexpected desc: %s", desc)
+		}
+		for _, name := range strings.Fields(m[1]) {
+			if !reservedLabelNames[name] {
+				t.Errorf("label %s of %s is not reserved", name, desc)
+			}
+		}
+	}
+}
+
+func TestLoadConfigRejectsReservedLabelNames(t *testing.T) {
+	for _, name := range []string{"target", "namespace", "queue", "class", "collector", "reason", "url", "command", "pattern", "quantile"} {
+		filename := filepath.Join(t.TempDir(), "config.yml")
+		writeConfig(t, filename, fmt.Sprintf(`
+targets:
+- url: redis://localhost:6379
+  labels:
+    %s: a
+`, name))
+		if _, err := loadConfig(filename); err == nil {
+			t.Errorf("expected an error for the label %s", name)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, filename, `
+targets:
+- url: redis://localhost:6379
+  labels:
+    env: production
+`)
+	if _, err := loadConfig(filename); err != nil {
+		t.Error(err)
+	}
+}
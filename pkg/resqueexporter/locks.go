@@ -0,0 +1,41 @@
+package resqueexporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobLocksKeyPrefix = Flags.String(
+		"job-locks.key-prefix",
+		"lock:",
+		"Prefix of the Redis keys, following the namespace, used as job locks.",
+	)
+)
+
+var (
+	jobLocksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_locks"),
+		"Number of currently held job locks.",
+		nil, nil,
+	)
+)
+
+func init() {
+	registerCollector("job-locks", false, "Collect the number of job locks held by plugins like resque-lonely_job.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeJobLocks(ch)
+	})
+}
+
+func (e *Collector) scrapeJobLocks(ch chan<- prometheus.Metric) error {
+	var locks int
+	err := e.scanKeys(e.redisKeyPattern(*jobLocksKeyPrefix+"*").String(), func(string) error {
+		locks++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(jobLocksDesc, prometheus.GaugeValue, float64(locks))
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package resqueexporter
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	logFormat = Flags.String(
+		"log.format",
+		"logfmt",
+		"Output format of log messages. One of: [logfmt, json]",
+	)
+	logLevel = Flags.String(
+		"log.level",
+		"info",
+		"Only log messages with the given severity or above. One of: [debug, info, warn, error, fatal]",
+	)
+)
+
+// setupLogging configures the logger with the --log.level and --log.format
+// flags.
+func setupLogging() error {
+	level, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+
+	switch *logFormat {
+	case "logfmt":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format: %s", *logFormat)
+	}
+
+	return nil
+}
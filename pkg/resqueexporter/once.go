@@ -0,0 +1,61 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	runOnce = Flags.Bool(
+		"once",
+		false,
+		"Scrape the targets once, print the metrics in the text format to the standard output and exit, with a non-zero status if the scrape failed.",
+	)
+)
+
+// scrapeOnce scrapes the targets, and writes the metrics in the text format.
+// An error is returned if the scrape of any of the targets failed.
+func (r *reloader) scrapeOnce(w io.Writer) error {
+	failed, err := r.writeMetrics(context.Background(), w)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of the scrapes failed", failed)
+	}
+	return nil
+}
+
+// writeMetrics scrapes the targets with the context, and writes the metrics
+// in the text format. The number of the targets whose scrape failed is
+// returned.
+func (r *reloader) writeMetrics(ctx context.Context, w io.Writer) (int, error) {
+	gatherer, err := r.gatherer(ctx)
+	if err != nil {
+		return 0, err
+	}
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		return 0, err
+	}
+
+	var failed int
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return 0, err
+		}
+		if mf.GetName() != namespace+"_up" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			if m.GetGauge().GetValue() == 0 {
+				failed++
+			}
+		}
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,291 @@
+package resqueexporter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+)
+
+const openMetricsContentType expfmt.Format = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// createdTTL is the duration after which the creation time of a counter not
+// written since is forgotten, e.g. of a queue that is removed.
+const createdTTL = time.Hour
+
+// counterCreated records the creation times of the counters for the _created
+// samples of the OpenMetrics format, as the metric families of the vendored
+// Prometheus client library can't carry them.
+var counterCreated = newCreatedTimes()
+
+// createdTimes tracks the creation times of the series of the counters. The
+// counters of the exporter itself are created along with the collectors
+// counting them. The others, e.g. the stats of Resque, are created when they
+// are first written, or when they are written after they are reset.
+type createdTimes struct {
+	mu       sync.Mutex
+	families map[string]time.Time
+	series   map[string]*createdSeries
+}
+
+type createdSeries struct {
+	created time.Time
+	value   float64
+	written time.Time
+}
+
+func newCreatedTimes() *createdTimes {
+	return &createdTimes{
+		families: make(map[string]time.Time),
+		series:   make(map[string]*createdSeries),
+	}
+}
+
+// family records that the counters of the family are created at the time,
+// resetting the ones created before.
+func (c *createdTimes) family(name string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.families[name] = t
+}
+
+// created returns the creation time of the series of the counter having the
+// value at the time.
+func (c *createdTimes) created(name string, m *dto.Metric, value float64, now time.Time) time.Time {
+	labels := make([]string, 0, len(m.Label))
+	for _, l := range m.Label {
+		labels = append(labels, l.GetName()+"="+strconv.Quote(l.GetValue()))
+	}
+	sort.Strings(labels)
+	key := name + "{" + strings.Join(labels, ",") + "}"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	familyCreated, isFamily := c.families[name]
+	s, ok := c.series[key]
+	switch {
+	case !ok && isFamily:
+		s = &createdSeries{created: familyCreated}
+		c.series[key] = s
+	case !ok:
+		s = &createdSeries{created: now}
+		c.series[key] = s
+	case isFamily && familyCreated.After(s.created):
+		s.created = familyCreated
+	case value < s.value:
+		s.created = now
+	}
+	s.value, s.written = value, now
+	return s.created
+}
+
+// expire forgets the series not written since the TTL.
+func (c *createdTimes) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, s := range c.series {
+		if now.Sub(s.written) > createdTTL {
+			delete(c.series, key)
+		}
+	}
+}
+
+// newCreatedCounter returns a counter recorded as created now.
+func newCreatedCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	counterCreated.family(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), time.Now())
+	return prometheus.NewCounter(opts)
+}
+
+// newCreatedCounterVec returns a counter vector recorded as created now.
+func newCreatedCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	counterCreated.family(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), time.Now())
+	return prometheus.NewCounterVec(opts, labelNames)
+}
+
+// metricsHandler serves the metrics of the targets of the reloader along with
+// the ones gathered by the default registry, in the OpenMetrics format to the
+// scrapers accepting it, and in the formats of the Prometheus client library
+// to the others. The scrapes of the targets are canceled when the request is
+// canceled or exceeds its scrape timeout. The requests are instrumented unless
+// --web.disable-exporter-metrics is given.
+func metricsHandler(r *reloader) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := scrapeContext(req)
+		defer cancel()
+
+		gatherer, err := r.gatherer(ctx)
+		var mfs []*dto.MetricFamily
+		if err == nil {
+			mfs, err = prometheus.Gatherers{prometheus.DefaultGatherer, gatherer}.Gather()
+		}
+		if err != nil {
+			http.Error(w, "An error has occurred during metrics collection:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		serveMetricFamilies(w, req, mfs)
+	})
+
+	if *disableExporterMetrics {
+		return handler
+	}
+	return prometheus.InstrumentHandler("prometheus", handler)
+}
+
+// serveMetricFamilies writes the metric families to the response in the
+// format negotiated with the request.
+func serveMetricFamilies(w http.ResponseWriter, req *http.Request, mfs []*dto.MetricFamily) {
+	openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+	contentType := expfmt.Negotiate(req.Header)
+	if openMetrics {
+		contentType = openMetricsContentType
+	}
+
+	var out io.Writer = w
+	w.Header().Set("Content-Type", string(contentType))
+	if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+
+	var err error
+	if openMetrics {
+		err = writeOpenMetrics(out, mfs)
+	} else {
+		enc := expfmt.NewEncoder(out, contentType)
+		for _, mf := range mfs {
+			if err = enc.Encode(mf); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to write the metrics: %s", err)
+	}
+}
+
+// writeOpenMetrics writes the metric families in the OpenMetrics text format.
+// The counters have _created samples of the times recorded by counterCreated.
+func writeOpenMetrics(out io.Writer, mfs []*dto.MetricFamily) error {
+	w := bufio.NewWriter(out)
+	now := time.Now()
+	defer counterCreated.expire(now)
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		typ := "unknown"
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			// The samples of counters are suffixed with _total, which
+			// is not part of the name of the family.
+			typ, name = "counter", strings.TrimSuffix(name, "_total")
+		case dto.MetricType_GAUGE:
+			typ = "gauge"
+		case dto.MetricType_SUMMARY:
+			typ = "summary"
+		case dto.MetricType_HISTOGRAM:
+			typ = "histogram"
+		}
+
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+		if mf.Help != nil {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, escapeOpenMetrics(mf.GetHelp()))
+		}
+
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				value := m.GetCounter().GetValue()
+				created := counterCreated.created(mf.GetName(), m, value, now)
+				writeOpenMetricsSample(w, name+"_total", m, "", "", value)
+				writeOpenMetricsSample(w, name+"_created", m, "", "", float64(created.UnixNano())/1e9)
+			case dto.MetricType_GAUGE:
+				writeOpenMetricsSample(w, name, m, "", "", m.GetGauge().GetValue())
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().Quantile {
+					writeOpenMetricsSample(w, name, m, "quantile", formatOpenMetricsFloat(q.GetQuantile()), q.GetValue())
+				}
+				writeOpenMetricsSample(w, name+"_sum", m, "", "", m.GetSummary().GetSampleSum())
+				writeOpenMetricsSample(w, name+"_count", m, "", "", float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				infSeen := false
+				for _, b := range m.GetHistogram().Bucket {
+					infSeen = infSeen || math.IsInf(b.GetUpperBound(), +1)
+					writeOpenMetricsSample(w, name+"_bucket", m, "le", formatOpenMetricsFloat(b.GetUpperBound()), float64(b.GetCumulativeCount()))
+				}
+				if !infSeen {
+					writeOpenMetricsSample(w, name+"_bucket", m, "le", "+Inf", float64(m.GetHistogram().GetSampleCount()))
+				}
+				writeOpenMetricsSample(w, name+"_sum", m, "", "", m.GetHistogram().GetSampleSum())
+				writeOpenMetricsSample(w, name+"_count", m, "", "", float64(m.GetHistogram().GetSampleCount()))
+			default:
+				writeOpenMetricsSample(w, name, m, "", "", m.GetUntyped().GetValue())
+			}
+		}
+	}
+	fmt.Fprint(w, "# EOF\n")
+
+	return w.Flush()
+}
+
+// writeOpenMetricsSample writes a sample of the metric, with the additional
+// label if its name is not empty.
+func writeOpenMetricsSample(w io.Writer, name string, m *dto.Metric, labelName, labelValue string, value float64) {
+	fmt.Fprint(w, name)
+
+	labels := m.Label
+	if labelName != "" {
+		labels = append(labels[:len(labels):len(labels)], &dto.LabelPair{Name: &labelName, Value: &labelValue})
+	}
+	if len(labels) > 0 {
+		fmt.Fprint(w, "{")
+		for i, l := range labels {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `%s="%s"`, l.GetName(), escapeOpenMetrics(l.GetValue()))
+		}
+		fmt.Fprint(w, "}")
+	}
+
+	fmt.Fprintf(w, " %s", formatOpenMetricsFloat(value))
+	if m.TimestampMs != nil {
+		fmt.Fprintf(w, " %s", formatOpenMetricsFloat(float64(m.GetTimestampMs())/1000))
+	}
+	fmt.Fprint(w, "\n")
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+func formatOpenMetricsFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
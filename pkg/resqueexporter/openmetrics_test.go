@@ -0,0 +1,79 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterMetric(value float64, labels ...string) *dto.Metric {
+	m := &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(value)}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(labels[i]), Value: proto.String(labels[i+1])})
+	}
+	return m
+}
+
+func TestCreatedTimes(t *testing.T) {
+	c := newCreatedTimes()
+	start := time.Unix(1000, 0)
+
+	// The stats of Resque are created when they are first written, and
+	// when they are written after they are reset.
+	if got := c.created("resque_job_executions_total", counterMetric(10), 10, start); !got.Equal(start) {
+		t.Errorf("got %v, want %v", got, start)
+	}
+	if got := c.created("resque_job_executions_total", counterMetric(20), 20, start.Add(time.Minute)); !got.Equal(start) {
+		t.Errorf("got %v, want %v", got, start)
+	}
+	reset := start.Add(2 * time.Minute)
+	if got := c.created("resque_job_executions_total", counterMetric(1), 1, reset); !got.Equal(reset) {
+		t.Errorf("got %v after a reset, want %v", got, reset)
+	}
+
+	// The counters of the exporter are created along with their
+	// collectors.
+	created := start.Add(-time.Minute)
+	c.family("resque_scrapes_total", created)
+	if got := c.created("resque_scrapes_total", counterMetric(1, "target", "a"), 1, start); !got.Equal(created) {
+		t.Errorf("got %v, want %v", got, created)
+	}
+	recreated := start.Add(time.Minute)
+	c.family("resque_scrapes_total", recreated)
+	if got := c.created("resque_scrapes_total", counterMetric(0, "target", "a"), 0, start.Add(2*time.Minute)); !got.Equal(recreated) {
+		t.Errorf("got %v after the collector is recreated, want %v", got, recreated)
+	}
+
+	c.expire(start.Add(2*time.Minute + createdTTL + time.Second))
+	if len(c.series) != 0 {
+		t.Errorf("%d series not expired", len(c.series))
+	}
+}
+
+func TestWriteOpenMetricsCreated(t *testing.T) {
+	counter := newCreatedCounter(prometheus.CounterOpts{Name: "test_created_total", Help: "Test counter."})
+	counter.Inc()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(counter)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := writeOpenMetrics(&b, mfs); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.Contains(out, "test_created_total 1\n") {
+		t.Errorf("no _total sample in:\n%s", out)
+	}
+	if !strings.Contains(out, "\ntest_created_created ") {
+		t.Errorf("no _created sample in:\n%s", out)
+	}
+}
@@ -0,0 +1,97 @@
+package resqueexporter
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Option configures a collector created by NewCollector. The settings not
+// given by options are taken from Flags.
+type Option func(*options)
+
+type options struct {
+	redisClient    redis.UniversalClient
+	redisURL       string
+	redisNamespace string
+	timeout        time.Duration
+	queueInclude   string
+	queueExclude   string
+	logger         log.FieldLogger
+	constLabels    prometheus.Labels
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		redisURL:       redisURLs.values[0],
+		redisNamespace: *redisNamespace,
+		queueInclude:   *queueInclude,
+		queueExclude:   *queueExclude,
+		logger:         log.StandardLogger(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRedisURL sets the URL to the Redis backing the Resque. The Redis given
+// by --redis.fallback-url are failed over to.
+func WithRedisURL(redisURL string) Option {
+	return func(o *options) {
+		o.redisURL = redisURL
+	}
+}
+
+// WithRedisClient sets the client of the Redis backing the Resque, e.g. one
+// already used by the program embedding the collector. The client is neither
+// instrumented nor closed by the collector, and the flags configuring the
+// connections to Redis are ignored.
+func WithRedisClient(client redis.UniversalClient) Option {
+	return func(o *options) {
+		o.redisClient = client
+	}
+}
+
+// WithRedisNamespace sets the namespace used by Resque to prefix all its Redis
+// keys. If multiple namespaces are given separated by commas, the metrics of
+// each namespace are labeled with it.
+func WithRedisNamespace(ns string) Option {
+	return func(o *options) {
+		o.redisNamespace = ns
+	}
+}
+
+// WithTimeout sets the maximum time a scrape of Redis can take. Zero means no
+// timeout. The timeout is checked between the commands to Redis, so the
+// command in flight when it expires is bounded by the read timeout instead.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithQueueFilter sets the regular expressions of the queues to include and
+// exclude, like --queue.include and --queue.exclude.
+func WithQueueFilter(include, exclude string) Option {
+	return func(o *options) {
+		o.queueInclude = include
+		o.queueExclude = exclude
+	}
+}
+
+// WithLogger sets the logger of the errors of the scrapes.
+func WithLogger(logger log.FieldLogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithConstLabels sets the labels added to all the metrics of the collector.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
@@ -0,0 +1,525 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	otlpEndpoint = Flags.String(
+		"otlp.endpoint",
+		"",
+		"URL of the OTLP/HTTP metrics endpoint of an OpenTelemetry Collector, e.g. http://localhost:4318/v1/metrics, to push the metrics to at the interval, in addition to serving them over HTTP.",
+	)
+	otlpProtocol = Flags.String(
+		"otlp.protocol",
+		"http/json",
+		"Protocol to push the metrics to the OTLP endpoint with, http/json or http/protobuf.",
+	)
+	otlpInterval = Flags.Duration(
+		"otlp.interval",
+		time.Minute,
+		"Interval to push the metrics to the OTLP endpoint at.",
+	)
+	otlpResourceAttributes = newStringsValue()
+)
+
+func init() {
+	Flags.Var(otlpResourceAttributes, "otlp.resource-attribute", "Attribute in the form of key=value of the resource of the metrics pushed to the OTLP endpoint. Can be repeated.")
+}
+
+// otlpSink pushes the metrics to an OTLP/HTTP endpoint in the JSON or the
+// protocol buffers encoding.
+type otlpSink struct {
+	endpoint   string
+	protocol   string
+	client     *http.Client
+	attributes []otlpAttribute
+}
+
+// The types below are the messages of the OTLP metrics in the JSON encoding,
+// in which the 64-bit integers are strings. They are also encoded in protocol
+// buffers by encodeOTLPRequest.
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string             `json:"key"`
+		Value otlpAttributeValue `json:"value"`
+	}
+	otlpAttributeValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpMetric struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Gauge       *otlpGauge     `json:"gauge,omitempty"`
+		Sum         *otlpSum       `json:"sum,omitempty"`
+		Histogram   *otlpHistogram `json:"histogram,omitempty"`
+		Summary     *otlpSummary   `json:"summary,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality int                   `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	}
+	otlpNumberDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsDouble          float64         `json:"asDouble"`
+	}
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality int                      `json:"aggregationTemporality"`
+	}
+	otlpHistogramDataPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		Count             string          `json:"count"`
+		Sum               float64         `json:"sum"`
+		BucketCounts      []string        `json:"bucketCounts"`
+		ExplicitBounds    []float64       `json:"explicitBounds"`
+	}
+	otlpSummary struct {
+		DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+	}
+	otlpSummaryDataPoint struct {
+		Attributes        []otlpAttribute     `json:"attributes,omitempty"`
+		StartTimeUnixNano string              `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string              `json:"timeUnixNano"`
+		Count             string              `json:"count"`
+		Sum               float64             `json:"sum"`
+		QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+	}
+	otlpQuantileValue struct {
+		Quantile float64 `json:"quantile"`
+		Value    float64 `json:"value"`
+	}
+)
+
+// otlpCumulative is the cumulative aggregation temporality of OTLP.
+const otlpCumulative = 2
+
+// The protocols of OTLP supported. OTLP/gRPC is not, as gRPC is not vendored.
+const (
+	otlpProtocolJSON     = "http/json"
+	otlpProtocolProtobuf = "http/protobuf"
+)
+
+// newOTLPSink returns an OTLP sink configured by the flags. The service.name
+// attribute of the resource defaults to resque_exporter.
+func newOTLPSink() (*otlpSink, error) {
+	if *otlpProtocol != otlpProtocolJSON && *otlpProtocol != otlpProtocolProtobuf {
+		return nil, fmt.Errorf("unsupported OTLP protocol: %s", *otlpProtocol)
+	}
+	s := &otlpSink{
+		endpoint: *otlpEndpoint,
+		protocol: *otlpProtocol,
+		client:   &http.Client{Timeout: *otlpInterval},
+	}
+	serviceName := false
+	for _, attribute := range otlpResourceAttributes.values {
+		parts := strings.SplitN(attribute, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid resource attribute: %s", attribute)
+		}
+		serviceName = serviceName || parts[0] == "service.name"
+		s.attributes = append(s.attributes, otlpAttribute{Key: parts[0], Value: otlpAttributeValue{parts[1]}})
+	}
+	if !serviceName {
+		s.attributes = append(s.attributes, otlpAttribute{Key: "service.name", Value: otlpAttributeValue{"resque_exporter"}})
+	}
+	return s, nil
+}
+
+// String implements sink.
+func (s *otlpSink) String() string {
+	return redactURL(s.endpoint)
+}
+
+// push implements sink.
+func (s *otlpSink) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	request := otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: s.attributes},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "resque_exporter", Version: version.Version},
+				Metrics: otlpMetrics(mfs, time.Now()),
+			}},
+		}},
+	}
+	contentType := "application/json"
+	var b []byte
+	if s.protocol == otlpProtocolProtobuf {
+		contentType, b = "application/x-protobuf", encodeOTLPRequest(request)
+	} else {
+		var err error
+		if b, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "resque_exporter/"+version.Version)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// otlpMetrics converts the metric families to the metrics of OTLP. The
+// counters are converted to the monotonic cumulative sums, and the untyped
+// metrics to the gauges. The cumulative points start at the creation times
+// recorded by counterCreated. The points whose values are NaN or infinite are
+// skipped, as encoding/json can't encode them, along with the quantiles of
+// the summaries whose values are, and the metrics left without points.
+func otlpMetrics(mfs []*dto.MetricFamily, now time.Time) []otlpMetric {
+	metrics := make([]otlpMetric, 0, len(mfs))
+	for _, mf := range mfs {
+		metric := otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		for _, m := range mf.Metric {
+			attributes := make([]otlpAttribute, 0, len(m.Label))
+			for _, l := range m.Label {
+				attributes = append(attributes, otlpAttribute{Key: l.GetName(), Value: otlpAttributeValue{l.GetValue()}})
+			}
+			timestamp := now.UnixNano()
+			if m.TimestampMs != nil {
+				timestamp = m.GetTimestampMs() * int64(time.Millisecond)
+			}
+			timeUnixNano := strconv.FormatInt(timestamp, 10)
+			startTimeUnixNano := func(value float64) string {
+				return strconv.FormatInt(counterCreated.created(mf.GetName(), m, value, now).UnixNano(), 10)
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				if !isFinite(m.GetCounter().GetValue()) {
+					continue
+				}
+				if metric.Sum == nil {
+					metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+				}
+				metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpNumberDataPoint{
+					Attributes:        attributes,
+					StartTimeUnixNano: startTimeUnixNano(m.GetCounter().GetValue()),
+					TimeUnixNano:      timeUnixNano,
+					AsDouble:          m.GetCounter().GetValue(),
+				})
+			case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+				value := m.GetGauge().GetValue()
+				if m.Untyped != nil {
+					value = m.GetUntyped().GetValue()
+				}
+				if !isFinite(value) {
+					continue
+				}
+				if metric.Gauge == nil {
+					metric.Gauge = &otlpGauge{}
+				}
+				metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpNumberDataPoint{Attributes: attributes, TimeUnixNano: timeUnixNano, AsDouble: value})
+			case dto.MetricType_HISTOGRAM:
+				if !isFinite(m.GetHistogram().GetSampleSum()) {
+					continue
+				}
+				if metric.Histogram == nil {
+					metric.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+				}
+				point := otlpHistogramPoint(m.GetHistogram(), attributes, timeUnixNano)
+				point.StartTimeUnixNano = startTimeUnixNano(float64(m.GetHistogram().GetSampleCount()))
+				metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, point)
+			case dto.MetricType_SUMMARY:
+				if !isFinite(m.GetSummary().GetSampleSum()) {
+					continue
+				}
+				if metric.Summary == nil {
+					metric.Summary = &otlpSummary{}
+				}
+				point := otlpSummaryDataPoint{
+					Attributes:        attributes,
+					StartTimeUnixNano: startTimeUnixNano(float64(m.GetSummary().GetSampleCount())),
+					TimeUnixNano:      timeUnixNano,
+					Count:             strconv.FormatUint(m.GetSummary().GetSampleCount(), 10),
+					Sum:               m.GetSummary().GetSampleSum(),
+					QuantileValues:    []otlpQuantileValue{},
+				}
+				for _, q := range m.GetSummary().Quantile {
+					if !isFinite(q.GetValue()) {
+						continue
+					}
+					point.QuantileValues = append(point.QuantileValues, otlpQuantileValue{q.GetQuantile(), q.GetValue()})
+				}
+				metric.Summary.DataPoints = append(metric.Summary.DataPoints, point)
+			}
+		}
+		if metric.Sum != nil || metric.Gauge != nil || metric.Histogram != nil || metric.Summary != nil {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+// isFinite reports whether the value is neither NaN nor infinite.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// otlpHistogramPoint converts the histogram to a data point of OTLP, whose
+// buckets are not cumulative.
+func otlpHistogramPoint(h *dto.Histogram, attributes []otlpAttribute, timeUnixNano string) otlpHistogramDataPoint {
+	point := otlpHistogramDataPoint{
+		Attributes:     attributes,
+		TimeUnixNano:   timeUnixNano,
+		Count:          strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:            h.GetSampleSum(),
+		BucketCounts:   []string{},
+		ExplicitBounds: []float64{},
+	}
+	var last uint64
+	for _, b := range h.Bucket {
+		if b.GetUpperBound() > 1e308 {
+			break
+		}
+		point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-last, 10))
+		last = b.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-last, 10))
+	return point
+}
+
+// encodeOTLPRequest encodes the request in the protocol buffer of the
+// ExportMetricsServiceRequest message of OTLP.
+func encodeOTLPRequest(r otlpRequest) []byte {
+	const (
+		requestResourceMetrics = 1<<3 | proto.WireBytes
+
+		resourceMetricsResource     = 1<<3 | proto.WireBytes
+		resourceMetricsScopeMetrics = 2<<3 | proto.WireBytes
+		resourceAttributes          = 1<<3 | proto.WireBytes
+		keyValueKey                 = 1<<3 | proto.WireBytes
+		keyValueValue               = 2<<3 | proto.WireBytes
+		anyValueStringValue         = 1<<3 | proto.WireBytes
+
+		scopeMetricsScope   = 1<<3 | proto.WireBytes
+		scopeMetricsMetrics = 2<<3 | proto.WireBytes
+		scopeName           = 1<<3 | proto.WireBytes
+		scopeVersion        = 2<<3 | proto.WireBytes
+
+		metricName        = 1<<3 | proto.WireBytes
+		metricDescription = 2<<3 | proto.WireBytes
+		metricGauge       = 5<<3 | proto.WireBytes
+		metricSum         = 7<<3 | proto.WireBytes
+		metricHistogram   = 9<<3 | proto.WireBytes
+		metricSummary     = 11<<3 | proto.WireBytes
+
+		dataPoints             = 1<<3 | proto.WireBytes
+		aggregationTemporality = 2<<3 | proto.WireVarint
+		sumIsMonotonic         = 3<<3 | proto.WireVarint
+
+		pointStartTimeUnixNano = 2<<3 | proto.WireFixed64
+		pointTimeUnixNano      = 3<<3 | proto.WireFixed64
+		pointCount             = 4<<3 | proto.WireFixed64
+		pointSum               = 5<<3 | proto.WireFixed64
+
+		numberPointAsDouble   = 4<<3 | proto.WireFixed64
+		numberPointAttributes = 7<<3 | proto.WireBytes
+
+		histogramPointBucketCounts   = 6<<3 | proto.WireBytes
+		histogramPointExplicitBounds = 7<<3 | proto.WireBytes
+		histogramPointAttributes     = 9<<3 | proto.WireBytes
+
+		summaryPointQuantileValues = 6<<3 | proto.WireBytes
+		summaryPointAttributes     = 7<<3 | proto.WireBytes
+		quantileValueQuantile      = 1<<3 | proto.WireFixed64
+		quantileValueValue         = 2<<3 | proto.WireFixed64
+	)
+
+	message := func(b *proto.Buffer, tag uint64, m *proto.Buffer) {
+		b.EncodeVarint(tag)
+		b.EncodeRawBytes(m.Bytes())
+	}
+	fixed64 := func(b *proto.Buffer, tag uint64, v uint64) {
+		b.EncodeVarint(tag)
+		b.EncodeFixed64(v)
+	}
+	// The 64-bit integers of the JSON encoding are strings.
+	parseFixed64 := func(b *proto.Buffer, tag uint64, v string) {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil && n > 0 {
+			fixed64(b, tag, n)
+		}
+	}
+	attributes := func(b *proto.Buffer, tag uint64, attributes []otlpAttribute) {
+		for _, a := range attributes {
+			value := proto.NewBuffer(nil)
+			value.EncodeVarint(anyValueStringValue)
+			value.EncodeStringBytes(a.Value.StringValue)
+			kv := proto.NewBuffer(nil)
+			kv.EncodeVarint(keyValueKey)
+			kv.EncodeStringBytes(a.Key)
+			message(kv, keyValueValue, value)
+			message(b, tag, kv)
+		}
+	}
+	numberPoints := func(b *proto.Buffer, points []otlpNumberDataPoint) {
+		for _, p := range points {
+			point := proto.NewBuffer(nil)
+			parseFixed64(point, pointStartTimeUnixNano, p.StartTimeUnixNano)
+			parseFixed64(point, pointTimeUnixNano, p.TimeUnixNano)
+			fixed64(point, numberPointAsDouble, math.Float64bits(p.AsDouble))
+			attributes(point, numberPointAttributes, p.Attributes)
+			message(b, dataPoints, point)
+		}
+	}
+
+	req := proto.NewBuffer(nil)
+	for _, rm := range r.ResourceMetrics {
+		resourceMetrics := proto.NewBuffer(nil)
+		resource := proto.NewBuffer(nil)
+		attributes(resource, resourceAttributes, rm.Resource.Attributes)
+		message(resourceMetrics, resourceMetricsResource, resource)
+
+		for _, sm := range rm.ScopeMetrics {
+			scopeMetrics := proto.NewBuffer(nil)
+			scope := proto.NewBuffer(nil)
+			scope.EncodeVarint(scopeName)
+			scope.EncodeStringBytes(sm.Scope.Name)
+			if sm.Scope.Version != "" {
+				scope.EncodeVarint(scopeVersion)
+				scope.EncodeStringBytes(sm.Scope.Version)
+			}
+			message(scopeMetrics, scopeMetricsScope, scope)
+
+			for _, m := range sm.Metrics {
+				metric := proto.NewBuffer(nil)
+				metric.EncodeVarint(metricName)
+				metric.EncodeStringBytes(m.Name)
+				if m.Description != "" {
+					metric.EncodeVarint(metricDescription)
+					metric.EncodeStringBytes(m.Description)
+				}
+				switch {
+				case m.Gauge != nil:
+					gauge := proto.NewBuffer(nil)
+					numberPoints(gauge, m.Gauge.DataPoints)
+					message(metric, metricGauge, gauge)
+				case m.Sum != nil:
+					sum := proto.NewBuffer(nil)
+					numberPoints(sum, m.Sum.DataPoints)
+					sum.EncodeVarint(aggregationTemporality)
+					sum.EncodeVarint(uint64(m.Sum.AggregationTemporality))
+					if m.Sum.IsMonotonic {
+						sum.EncodeVarint(sumIsMonotonic)
+						sum.EncodeVarint(1)
+					}
+					message(metric, metricSum, sum)
+				case m.Histogram != nil:
+					histogram := proto.NewBuffer(nil)
+					for _, p := range m.Histogram.DataPoints {
+						point := proto.NewBuffer(nil)
+						parseFixed64(point, pointStartTimeUnixNano, p.StartTimeUnixNano)
+						parseFixed64(point, pointTimeUnixNano, p.TimeUnixNano)
+						parseFixed64(point, pointCount, p.Count)
+						fixed64(point, pointSum, math.Float64bits(p.Sum))
+						// The repeated scalars are packed.
+						counts := proto.NewBuffer(nil)
+						for _, c := range p.BucketCounts {
+							n, _ := strconv.ParseUint(c, 10, 64)
+							counts.EncodeFixed64(n)
+						}
+						message(point, histogramPointBucketCounts, counts)
+						bounds := proto.NewBuffer(nil)
+						for _, bound := range p.ExplicitBounds {
+							bounds.EncodeFixed64(math.Float64bits(bound))
+						}
+						message(point, histogramPointExplicitBounds, bounds)
+						attributes(point, histogramPointAttributes, p.Attributes)
+						message(histogram, dataPoints, point)
+					}
+					histogram.EncodeVarint(aggregationTemporality)
+					histogram.EncodeVarint(uint64(m.Histogram.AggregationTemporality))
+					message(metric, metricHistogram, histogram)
+				case m.Summary != nil:
+					summary := proto.NewBuffer(nil)
+					for _, p := range m.Summary.DataPoints {
+						point := proto.NewBuffer(nil)
+						parseFixed64(point, pointStartTimeUnixNano, p.StartTimeUnixNano)
+						parseFixed64(point, pointTimeUnixNano, p.TimeUnixNano)
+						parseFixed64(point, pointCount, p.Count)
+						fixed64(point, pointSum, math.Float64bits(p.Sum))
+						for _, q := range p.QuantileValues {
+							quantile := proto.NewBuffer(nil)
+							fixed64(quantile, quantileValueQuantile, math.Float64bits(q.Quantile))
+							fixed64(quantile, quantileValueValue, math.Float64bits(q.Value))
+							message(point, summaryPointQuantileValues, quantile)
+						}
+						attributes(point, summaryPointAttributes, p.Attributes)
+						message(summary, dataPoints, point)
+					}
+					message(metric, metricSummary, summary)
+				}
+				message(scopeMetrics, scopeMetricsMetrics, metric)
+			}
+			message(resourceMetrics, resourceMetricsScopeMetrics, scopeMetrics)
+		}
+		message(req, requestResourceMetrics, resourceMetrics)
+	}
+	return req.Bytes()
+}
+
+// startOTLP starts pushing the metrics of the targets to the OTLP endpoint
+// given by --otlp.endpoint until the context is done.
+func startOTLP(ctx context.Context, r *reloader) error {
+	s, err := newOTLPSink()
+	if err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, s, *otlpInterval)
+	return nil
+}
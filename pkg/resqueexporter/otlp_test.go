@@ -0,0 +1,229 @@
+package resqueexporter
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func otlpTestFamilies() []*dto.MetricFamily {
+	return []*dto.MetricFamily{
+		{
+			Name:   proto.String("resque_job_executions_total"),
+			Help:   proto.String("Total number of job executions."),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{counterMetric(10, "namespace", "resque")},
+		},
+		{
+			Name: proto.String("resque_queues"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Gauge: &dto.Gauge{Value: proto.Float64(2)},
+			}},
+		},
+	}
+}
+
+func TestOTLPMetricsStartTime(t *testing.T) {
+	now := time.Now()
+	metrics := otlpMetrics(otlpTestFamilies(), now)
+
+	sum := metrics[0].Sum
+	if sum == nil || len(sum.DataPoints) != 1 {
+		t.Fatalf("got %+v, want a sum with a data point", metrics[0])
+	}
+	if sum.DataPoints[0].StartTimeUnixNano == "" {
+		t.Error("no start time of the cumulative sum")
+	}
+	gauge := metrics[1].Gauge
+	if gauge == nil || len(gauge.DataPoints) != 1 {
+		t.Fatalf("got %+v, want a gauge with a data point", metrics[1])
+	}
+	if gauge.DataPoints[0].StartTimeUnixNano != "" {
+		t.Error("unexpected start time of the gauge")
+	}
+
+	b, err := json.Marshal(sum.DataPoints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var point map[string]interface{}
+	if err := json.Unmarshal(b, &point); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := point["startTimeUnixNano"]; !ok {
+		t.Errorf("no startTimeUnixNano in %s", b)
+	}
+}
+
+// protoField is a field of a protocol buffer message.
+type protoField struct {
+	number  uint64
+	fixed64 uint64
+	varint  uint64
+	bytes   []byte
+}
+
+// decodeProto decodes the fields of a message encoded in protocol buffers.
+func decodeProto(t *testing.T, b []byte) map[uint64][]protoField {
+	t.Helper()
+
+	fields := make(map[uint64][]protoField)
+	for len(b) > 0 {
+		tag, n := proto.DecodeVarint(b)
+		if n == 0 {
+			t.Fatal("invalid tag")
+		}
+		b = b[n:]
+		f := protoField{number: tag >> 3}
+		switch tag & 7 {
+		case proto.WireVarint:
+			f.varint, n = proto.DecodeVarint(b)
+		case proto.WireFixed64:
+			if len(b) < 8 {
+				t.Fatal("truncated fixed64")
+			}
+			f.fixed64, n = binary.LittleEndian.Uint64(b), 8
+		case proto.WireBytes:
+			var size uint64
+			size, n = proto.DecodeVarint(b)
+			if n == 0 || uint64(len(b)-n) < size {
+				t.Fatal("truncated bytes")
+			}
+			f.bytes, n = b[n:n+int(size)], n+int(size)
+		default:
+			t.Fatalf("unexpected wire type of tag %d", tag)
+		}
+		if n == 0 {
+			t.Fatal("invalid field")
+		}
+		b = b[n:]
+		fields[f.number] = append(fields[f.number], f)
+	}
+	return fields
+}
+
+func TestEncodeOTLPRequest(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := encodeOTLPRequest(otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{{
+			Resource: otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAttributeValue{"resque_exporter"}}}},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScope{Name: "resque_exporter"},
+				Metrics: otlpMetrics(otlpTestFamilies(), now),
+			}},
+		}},
+	})
+
+	request := decodeProto(t, b)
+	resourceMetrics := decodeProto(t, request[1][0].bytes)
+	resource := decodeProto(t, resourceMetrics[1][0].bytes)
+	attribute := decodeProto(t, resource[1][0].bytes)
+	if key := string(attribute[1][0].bytes); key != "service.name" {
+		t.Errorf("got attribute %q, want service.name", key)
+	}
+
+	scopeMetrics := decodeProto(t, resourceMetrics[2][0].bytes)
+	metrics := scopeMetrics[2]
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2", len(metrics))
+	}
+
+	metric := decodeProto(t, metrics[0].bytes)
+	if name := string(metric[1][0].bytes); name != "resque_job_executions_total" {
+		t.Errorf("got metric %q, want resque_job_executions_total", name)
+	}
+	sum := decodeProto(t, metric[7][0].bytes)
+	if temporality := sum[2][0].varint; temporality != otlpCumulative {
+		t.Errorf("got aggregation temporality %d, want %d", temporality, otlpCumulative)
+	}
+	if monotonic := sum[3][0].varint; monotonic != 1 {
+		t.Error("the sum is not monotonic")
+	}
+	point := decodeProto(t, sum[1][0].bytes)
+	if start := point[2]; len(start) != 1 || start[0].fixed64 == 0 {
+		t.Error("no start time of the cumulative sum")
+	}
+	if ts := point[3][0].fixed64; ts != uint64(now.UnixNano()) {
+		t.Errorf("got time %d, want %d", ts, now.UnixNano())
+	}
+	if value := math.Float64frombits(point[4][0].fixed64); value != 10 {
+		t.Errorf("got value %v, want 10", value)
+	}
+
+	gauge := decodeProto(t, decodeProto(t, metrics[1].bytes)[5][0].bytes)
+	if _, ok := decodeProto(t, gauge[1][0].bytes)[2]; ok {
+		t.Error("unexpected start time of the gauge")
+	}
+}
+
+func TestOTLPSinkPushSkipsNonFiniteValues(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	mfs := append(otlpTestFamilies(),
+		&dto.MetricFamily{
+			Name: proto.String("test_nan"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{
+				{Gauge: &dto.Gauge{Value: proto.Float64(math.NaN())}},
+				{Gauge: &dto.Gauge{Value: proto.Float64(math.Inf(1))}},
+			},
+		},
+		&dto.MetricFamily{
+			Name: proto.String("test_job_duration_seconds"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(0),
+					SampleSum:   proto.Float64(0),
+					Quantile: []*dto.Quantile{
+						{Quantile: proto.Float64(0.5), Value: proto.Float64(math.NaN())},
+						{Quantile: proto.Float64(0.9), Value: proto.Float64(1)},
+					},
+				},
+			}},
+		},
+	)
+	mfs[0].Metric = append(mfs[0].Metric, counterMetric(math.Inf(-1), "namespace", "other"))
+
+	s := &otlpSink{endpoint: srv.URL, protocol: "http/json", client: srv.Client()}
+	if err := s.push(context.Background(), mfs); err != nil {
+		t.Fatal(err)
+	}
+
+	var request otlpRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("invalid request %s: %s", body, err)
+	}
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	names := make(map[string]otlpMetric)
+	for _, m := range metrics {
+		names[m.Name] = m
+	}
+	if _, ok := names["test_nan"]; ok {
+		t.Error("the metric without finite values is pushed")
+	}
+	if sum := names["resque_job_executions_total"].Sum; sum == nil || len(sum.DataPoints) != 1 {
+		t.Errorf("got %+v, want the finite point of the counter", sum)
+	}
+	summary := names["test_job_duration_seconds"].Summary
+	if summary == nil || len(summary.DataPoints) != 1 {
+		t.Fatalf("got %+v, want a summary with a data point", summary)
+	}
+	if q := summary.DataPoints[0].QuantileValues; len(q) != 1 || q[0].Quantile != 0.9 {
+		t.Errorf("got quantiles %+v, want the finite one", q)
+	}
+}
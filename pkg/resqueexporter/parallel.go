@@ -0,0 +1,94 @@
+package resqueexporter
+
+import (
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	scrapeParallelism = Flags.Int(
+		"scrape.parallelism",
+		4,
+		"Maximum number of concurrent Redis round trips collecting the queues and workers of a scrape.",
+	)
+)
+
+// pipelineBatchSize is the maximum number of commands sent in a pipeline.
+const pipelineBatchSize = 1000
+
+// parallel calls fn for each of 0 to n-1, with up to --scrape.parallelism
+// calls running at a time. It returns the first error returned by fn, after
+// which no more calls are started.
+func parallel(n int, fn func(i int) error) error {
+	workers := *scrapeParallelism
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && !failed(); i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return firstErr
+}
+
+// pipelined calls fn for each of 0 to n-1 to queue n commands to pipelines of
+// up to pipelineBatchSize commands, and executes the pipelines in parallel.
+// It returns the first error of the pipelines, except for the commands failing
+// because of the types of their keys, which are left for fn's caller to check.
+func (e *Collector) pipelined(n int, fn func(pipe redis.Pipeliner, i int)) error {
+	batches := (n + pipelineBatchSize - 1) / pipelineBatchSize
+	return parallel(batches, func(batch int) error {
+		if err := e.canceled(); err != nil {
+			return err
+		}
+		_, err := e.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
+			for i := batch * pipelineBatchSize; i < n && i < (batch+1)*pipelineBatchSize; i++ {
+				fn(pipe, i)
+			}
+			return nil
+		})
+		if isWrongTypeError(err) {
+			return nil
+		}
+		return err
+	})
+}
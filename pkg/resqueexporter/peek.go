@@ -0,0 +1,138 @@
+package resqueexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	peekTokenFile = Flags.String(
+		"web.peek-token-file",
+		"",
+		"File containing the bearer token authorizing requests to /api/v1/queues/<queue>/peek, which returns the jobs at the head of the queue. The endpoint is disabled without it. Re-read on every request.",
+	)
+)
+
+const (
+	// peekAPIDefaultLimit and peekAPIMaxLimit are the default and the
+	// maximum numbers of the jobs returned by the API.
+	peekAPIDefaultLimit = 10
+	peekAPIMaxLimit     = 100
+)
+
+// peekedJob is a job at the head of a queue returned by the API.
+type peekedJob struct {
+	Target    string `json:"target,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Position is the index of the job in the queue.
+	Position int64 `json:"position"`
+	// Payload is the payload of the job as is if it is valid JSON, or as a
+	// string otherwise.
+	Payload json.RawMessage `json:"payload"`
+}
+
+// peek returns the jobs of the queue from the position like Resque.peek, in
+// all the namespaces of all the targets.
+func (r *reloader) peek(ctx context.Context, queue string, start, limit int64) ([]peekedJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobs := []peekedJob{}
+	for i, exporter := range r.exporters {
+		client, _ := exporter.redisEndpoints.get()
+		exporter = exporter.withClient(contextClient(ctx, client))
+
+		namespaces := exporter.redisNamespaces
+		if namespaces == nil {
+			namespaces = []string{exporter.redisNamespace}
+		}
+		for _, ns := range namespaces {
+			e := exporter.withNamespace(ns)
+			payloads, err := e.redisClient.LRange(e.redisKey("queue", queue), start, start+limit-1).Result()
+			if err != nil {
+				return nil, err
+			}
+			for j, payload := range payloads {
+				job := peekedJob{Position: start + int64(j), Payload: json.RawMessage(payload)}
+				if !json.Valid(job.Payload) {
+					job.Payload, _ = json.Marshal(payload)
+				}
+				if exporter.redisNamespaces != nil {
+					job.Namespace = ns
+				}
+				if len(r.targets) > 1 {
+					job.Target = redactedURL(r.targets[i].URL).String()
+				}
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	// The commands are skipped without errors once the context is done.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// servePeek serves the jobs at the head of the queue given by the path as
+// JSON to the requests bearing the token. The number of the jobs is given by
+// the limit parameter, and the position of the first job by the start
+// parameter.
+func (r *reloader) servePeek(w http.ResponseWriter, req *http.Request) {
+	queue := strings.TrimPrefix(req.URL.Path, "/api/v1/queues/")
+	if !strings.HasSuffix(queue, "/peek") || queue == "/peek" {
+		http.NotFound(w, req)
+		return
+	}
+	queue = strings.TrimSuffix(queue, "/peek")
+
+	token, err := readToken(*peekTokenFile)
+	if err != nil {
+		log.Errorf("Failed to read the peek token: %s", err)
+		http.Error(w, "Failed to read the peek token", http.StatusInternalServerError)
+		return
+	}
+	if !hasBearerToken(req, token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	start, limit := int64(0), int64(peekAPIDefaultLimit)
+	if v := req.URL.Query().Get("start"); v != "" {
+		if start, err = strconv.ParseInt(v, 10, 64); err != nil || start < 0 {
+			http.Error(w, fmt.Sprintf("Invalid start: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := req.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", v), http.StatusBadRequest)
+			return
+		}
+		if limit > peekAPIMaxLimit {
+			limit = peekAPIMaxLimit
+		}
+	}
+
+	jobs, err := r.peek(req.Context(), queue, start, limit)
+	if err != nil {
+		log.Errorf("Failed to peek the queue %s: %s", queue, err)
+		http.Error(w, fmt.Sprintf("Failed to peek the queue %s: %s", queue, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Queue string      `json:"queue"`
+		Jobs  []peekedJob `json:"jobs"`
+	}{queue, jobs}); err != nil {
+		log.Errorf("Failed to write the jobs of the queue %s: %s", queue, err)
+	}
+}
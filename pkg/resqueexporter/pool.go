@@ -0,0 +1,137 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "hits_total"),
+		"Total number of times a free connection to the Redis was found in the pool.",
+		nil, nil,
+	)
+	poolMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "misses_total"),
+		"Total number of times a free connection to the Redis was not found in the pool.",
+		nil, nil,
+	)
+	poolTimeoutsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "timeouts_total"),
+		"Total number of times waiting for a connection to the Redis from the pool timed out.",
+		nil, nil,
+	)
+	poolConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "connections"),
+		"Number of connections to the Redis in the pool.",
+		nil, nil,
+	)
+	poolIdleConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "idle_connections"),
+		"Number of idle connections to the Redis in the pool.",
+		nil, nil,
+	)
+	poolStaleConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis_pool", "stale_connections_total"),
+		"Total number of stale connections to the Redis removed from the pool.",
+		nil, nil,
+	)
+)
+
+type poolStatser interface {
+	PoolStats() *redis.PoolStats
+}
+
+func describePoolStats(ch chan<- *prometheus.Desc) {
+	ch <- poolHitsDesc
+	ch <- poolMissesDesc
+	ch <- poolTimeoutsDesc
+	ch <- poolConnectionsDesc
+	ch <- poolIdleConnectionsDesc
+	ch <- poolStaleConnectionsDesc
+}
+
+// collectPoolStats exports the statistics of the connection pool of the
+// client.
+func collectPoolStats(ch chan<- prometheus.Metric, client redis.UniversalClient) {
+	c, ok := client.(poolStatser)
+	if !ok {
+		return
+	}
+	stats := c.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(poolHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(poolMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(poolTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(poolConnectionsDesc, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(poolIdleConnectionsDesc, prometheus.GaugeValue, float64(stats.FreeConns))
+	ch <- prometheus.MustNewConstMetric(poolStaleConnectionsDesc, prometheus.CounterValue, float64(stats.StaleConns))
+}
+
+// warmPool opens connections to the Redis until the pool of the client has at
+// least n idle ones, as the vendored go-redis has no MinIdleConns option. Each
+// of n transactions pings the Redis to take a connection of its own from the
+// pool, and holds it until all of them have one, so that n distinct
+// connections are returned to the pool. It does nothing for the clients of
+// Redis Cluster, whose pools are per node.
+func warmPool(client redis.UniversalClient, n int) {
+	c, ok := client.(*redis.Client)
+	if !ok || int(c.PoolStats().FreeConns) >= n {
+		return
+	}
+
+	var pinged, done sync.WaitGroup
+	pinged.Add(n)
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer done.Done()
+			c.Watch(func(tx *redis.Tx) error {
+				err := tx.Ping().Err()
+				pinged.Done()
+				pinged.Wait()
+				return err
+			})
+		}()
+	}
+	done.Wait()
+}
+
+// checkMinIdleConns returns an error unless the pools of the clients can hold
+// n idle connections. Warming a pool with more connections than it can hold
+// would take all of its connections, making the scrapes wait for them.
+func (e *endpoints) checkMinIdleConns(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid --redis.min-idle-conns: %d", n)
+	}
+	for i, client := range e.clients {
+		if c, ok := client.(*redis.Client); ok && n > c.Options().PoolSize {
+			return fmt.Errorf("--redis.min-idle-conns %d is greater than the pool size %d of %s", n, c.Options().PoolSize, redactedURL(e.urls[i]))
+		}
+	}
+	return nil
+}
+
+// warmPool warms the pool of the client with n idle connections, unless it is
+// already being warmed, e.g. after the previous scrape.
+func (e *endpoints) warmPool(client redis.UniversalClient, n int) {
+	e.mu.Lock()
+	if e.warming[client] {
+		e.mu.Unlock()
+		return
+	}
+	if e.warming == nil {
+		e.warming = make(map[redis.UniversalClient]bool)
+	}
+	e.warming[client] = true
+	e.mu.Unlock()
+
+	warmPool(client, n)
+
+	e.mu.Lock()
+	delete(e.warming, client)
+	e.mu.Unlock()
+}
@@ -0,0 +1,75 @@
+package resqueexporter
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis"
+)
+
+func TestWarmPool(t *testing.T) {
+	r := newFakeRedis(t)
+	client, err := newRedisClient(r.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	warmPool(client, 3)
+
+	stats := client.(poolStatser).PoolStats()
+	if stats.FreeConns != 3 || stats.TotalConns != 3 {
+		t.Errorf("got %d idle connections of %d, want 3 of 3", stats.FreeConns, stats.TotalConns)
+	}
+
+	// The pool already warmed is left as is.
+	warmPool(client, 2)
+	if stats := client.(poolStatser).PoolStats(); stats.TotalConns != 3 {
+		t.Errorf("got %d connections, want 3", stats.TotalConns)
+	}
+}
+
+func TestEndpointsWarmPoolInProgress(t *testing.T) {
+	r := newFakeRedis(t)
+	e, err := newEndpoints([]string{r.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.close()
+	client, _ := e.get()
+
+	// The pool being warmed, e.g. after the previous scrape, isn't warmed
+	// again.
+	e.warming = map[redis.UniversalClient]bool{client: true}
+	e.warmPool(client, 3)
+	if stats := client.(poolStatser).PoolStats(); stats.TotalConns != 0 {
+		t.Errorf("got %d connections, want 0", stats.TotalConns)
+	}
+
+	delete(e.warming, client)
+	e.warmPool(client, 3)
+	if stats := client.(poolStatser).PoolStats(); stats.FreeConns != 3 {
+		t.Errorf("got %d idle connections, want 3", stats.FreeConns)
+	}
+	if e.warming[client] {
+		t.Error("the pool is still marked as being warmed")
+	}
+}
+
+func TestNewCollectorMinIdleConnsOverPoolSize(t *testing.T) {
+	r := newFakeRedis(t)
+	setFlags(t, map[string]string{"redis.min-idle-conns": "3"})
+
+	if _, err := NewCollector(WithRedisURL(r.url() + "?pool_size=2")); err == nil {
+		t.Error("expected an error for more idle connections than the pool size")
+	}
+	c, err := NewCollector(WithRedisURL(r.url() + "?pool_size=3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	setFlags(t, map[string]string{"redis.min-idle-conns": "-1"})
+	if _, err := NewCollector(WithRedisURL(r.url())); err == nil {
+		t.Error("expected an error for a negative number of idle connections")
+	}
+}
@@ -0,0 +1,101 @@
+package resqueexporter
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	queueInclude = Flags.String(
+		"queue.include",
+		"",
+		"Regular expression matching the names of the queues and the failed queues to collect metrics of. All the queues are collected if empty.",
+	)
+	queueExclude = Flags.String(
+		"queue.exclude",
+		"",
+		"Regular expression matching the names of the queues and the failed queues not to collect metrics of.",
+	)
+	queueStaticList = Flags.String(
+		"queue.static-list",
+		"",
+		"Comma-separated names of the queues always reported, with 0 jobs while they are missing from the set of queues, regardless of the filters.",
+	)
+)
+
+// staticQueues returns the queues given by --queue.static-list.
+func staticQueues() []string {
+	var queues []string
+	for _, queue := range strings.Split(*queueStaticList, ",") {
+		if queue = strings.TrimSpace(queue); queue != "" {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// withStaticQueues returns the queues with the static queues missing from
+// them appended.
+func withStaticQueues(queues []string) []string {
+	static := staticQueues()
+	if len(static) == 0 {
+		return queues
+	}
+	seen := make(map[string]bool, len(queues))
+	for _, queue := range queues {
+		seen[queue] = true
+	}
+	merged := append([]string(nil), queues...)
+	for _, queue := range static {
+		if !seen[queue] {
+			seen[queue] = true
+			merged = append(merged, queue)
+		}
+	}
+	return merged
+}
+
+// queueFilter filters the queues by the regular expressions given by
+// --queue.include and --queue.exclude.
+type queueFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newQueueFilter(include, exclude string) (*queueFilter, error) {
+	var f queueFilter
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+// match reports whether the metrics of the queue are collected.
+func (f *queueFilter) match(queue string) bool {
+	if f.include != nil && !f.include.MatchString(queue) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(queue)
+}
+
+// filter returns the queues whose metrics are collected.
+func (f *queueFilter) filter(queues []string) []string {
+	if f.include == nil && f.exclude == nil {
+		return queues
+	}
+	filtered := make([]string, 0, len(queues))
+	for _, queue := range queues {
+		if f.match(queue) {
+			filtered = append(filtered, queue)
+		}
+	}
+	return filtered
+}
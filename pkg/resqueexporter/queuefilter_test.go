@@ -0,0 +1,47 @@
+package resqueexporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueueFilter(t *testing.T) {
+	queues := []string{"default", "mailers", "default_test", "low"}
+
+	for _, tc := range []struct {
+		include, exclude string
+		want             []string
+	}{
+		{"", "", queues},
+		{"^default", "", []string{"default", "default_test"}},
+		{"", "_test$", []string{"default", "mailers", "low"}},
+		{"^default", "_test$", []string{"default"}},
+	} {
+		f, err := newQueueFilter(tc.include, tc.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.filter(queues); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("include %q exclude %q: got %v, want %v", tc.include, tc.exclude, got, tc.want)
+		}
+	}
+}
+
+func TestQueueFilterInvalid(t *testing.T) {
+	if _, err := newQueueFilter("(", ""); err == nil {
+		t.Error("expected an error for an invalid include")
+	}
+	if _, err := newQueueFilter("", "["); err == nil {
+		t.Error("expected an error for an invalid exclude")
+	}
+}
+
+func TestWithStaticQueues(t *testing.T) {
+	setFlags(t, map[string]string{"queue.static-list": "critical,default, "})
+
+	got := withStaticQueues([]string{"default", "low"})
+	want := []string{"default", "low", "critical"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
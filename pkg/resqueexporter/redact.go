@@ -0,0 +1,55 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces the secrets in the values of the flags and in the
+// configuration.
+const redacted = "xxxxx"
+
+// redactedURL is a URL, e.g. of a Redis, that is printed without its
+// credentials. The URLs in logs, errors, labels and responses are printed as
+// redactedURL, so that the passwords in them never leak.
+type redactedURL string
+
+// String implements fmt.Stringer. A URL that can't be parsed is printed with
+// everything between its scheme and the last @ removed.
+func (r redactedURL) String() string {
+	u, err := url.Parse(string(r))
+	if err != nil {
+		s := string(r)
+		if i, j := strings.Index(s, "://"), strings.LastIndex(s, "@"); i >= 0 && j > i {
+			return s[:i+len("://")] + s[j+1:]
+		}
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
+
+// redactURL returns the URL with its password replaced, keeping the user
+// name, e.g. to show the configuration.
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// parseURL parses the URL like url.Parse, with an error without the
+// credentials. The cause of the error is left out, as it can quote a part of
+// the password, e.g. an invalid escape.
+func parseURL(rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %s", redactedURL(rawurl))
+	}
+	return u, nil
+}
@@ -0,0 +1,27 @@
+package resqueexporter
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// redisCmdable is the subset of the commands of redis.UniversalClient the
+// collectors run against Redis. The collectors depend on it rather than on
+// the whole client, so that they can be run against a fake Redis.
+type redisCmdable interface {
+	Exists(keys ...string) *redis.IntCmd
+	Get(key string) *redis.StringCmd
+	HGetAll(key string) *redis.StringStringMapCmd
+	HLen(key string) *redis.IntCmd
+	LLen(key string) *redis.IntCmd
+	LRange(key string, start, stop int64) *redis.StringSliceCmd
+	Ping() *redis.StatusCmd
+	Pipelined(fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	Process(cmd redis.Cmder) error
+	SCard(key string) *redis.IntCmd
+	SMembers(key string) *redis.StringSliceCmd
+	SScan(key string, cursor uint64, match string, count int64) *redis.ScanCmd
+	Scan(cursor uint64, match string, count int64) *redis.ScanCmd
+	Time() *redis.TimeCmd
+	Type(key string) *redis.StatusCmd
+	ZRange(key string, start, stop int64) *redis.StringSliceCmd
+}
@@ -0,0 +1,262 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	reloadTokenFile = Flags.String(
+		"web.reload-token-file",
+		"",
+		"File containing the bearer token authorizing POST requests to /-/reload. The endpoint is disabled without it. Re-read on every request.",
+	)
+)
+
+// contextCollector is a prometheus.Collector whose collection can be canceled
+// by a context.
+type contextCollector interface {
+	prometheus.Collector
+	collect(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// reloader collects metrics from the targets of the configuration, which can
+// be reloaded without restarting the exporter. It implements
+// prometheus.Collector and http.Handler.
+type reloader struct {
+	explicit map[string]bool
+
+	// mu keeps the configuration from being reloaded during scrapes, as
+	// the configuration file is applied to the flags.
+	mu        sync.RWMutex
+	collector contextCollector
+	exporters []*Collector
+	targets   []targetConfig
+
+	// cache keeps the metrics of the last scrape if --scrape.cache-ttl is
+	// given.
+	cache scrapeCache
+	// group coalesces the concurrent scrapes.
+	group scrapeGroup
+	// snapshot is the metrics of the last background scrape if
+	// --scrape.interval is given.
+	snapshot snapshot
+	// depths tracks the numbers of jobs in the queues observed by the
+	// background scrapes.
+	depths depthTracker
+
+	// lastCollect is the time the last scrape finished, or the time the
+	// exporter started before the first scrape.
+	lastCollectMu sync.Mutex
+	lastCollect   time.Time
+}
+
+// newReloader returns a reloader with the configuration loaded. The flags
+// given on the command line take precedence over the configuration file.
+func newReloader(explicit map[string]bool) (*reloader, error) {
+	r := &reloader{explicit: explicit, lastCollect: time.Now()}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the configuration and replaces the exporters with the ones of
+// the new configuration. The configuration is left untouched on errors.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var config *config
+	if *configFile != "" {
+		var err error
+		if config, err = loadConfig(*configFile); err != nil {
+			return err
+		}
+	}
+
+	targets, err := resolveTargets(config, r.explicit)
+	if err != nil {
+		return err
+	}
+	// The collectors read the queue filters and the like from the flags
+	// when they are built, so the configuration is applied first, and
+	// reverted if they can't be built.
+	restore := func() {}
+	if config != nil {
+		restore = config.apply(r.explicit)
+	}
+	var (
+		collector contextCollector
+		exporters []*Collector
+	)
+	if *demo {
+		// The demo has no targets to connect to.
+		collector, targets = newDemoCollector(), nil
+	} else if collector, exporters, err = newTargetsCollector(targets); err != nil {
+		restore()
+		return err
+	}
+
+	for _, exporter := range r.exporters {
+		exporter.Close()
+	}
+	r.collector, r.exporters, r.targets = collector, exporters, targets
+	r.cache.reset()
+	r.snapshot.reset()
+	r.depths.reset()
+
+	// The connections to Redis are established lazily, so an unreachable
+	// Redis doesn't prevent the exporter from starting. Scrapes report
+	// resque_up 0 until it becomes reachable.
+	for i, exporter := range exporters {
+		go func(exporter *Collector, target redactedURL) {
+			if err := exporter.redisClient.Ping().Err(); err != nil {
+				log.Warnf("Redis %s is not reachable yet: %s", target, err)
+			} else if exporter.minIdleConns > 0 {
+				client, _ := exporter.redisEndpoints.get()
+				exporter.redisEndpoints.warmPool(client, exporter.minIdleConns)
+			}
+		}(exporter, redactedURL(targets[i].URL))
+	}
+
+	log.Infof("Loaded the configuration with %d targets", len(targets))
+	return nil
+}
+
+// close closes the connections to the Redis of all the targets.
+func (r *reloader) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, exporter := range r.exporters {
+		exporter.Close()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.collector.Describe(ch)
+	ch <- lastScrapeTimestampDesc
+	describeDepths(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.collect(context.Background(), ch)
+}
+
+// collect collects the metrics of the targets, canceling the scrapes when the
+// context is done. The metrics of the last background scrape, or of the last
+// scrape if they are cached, are reused, and concurrent scrapes share the
+// metrics of a single scrape of Redis.
+func (r *reloader) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if *scrapeInterval > 0 {
+		// Until the first background scrape, Redis is scraped on
+		// demand.
+		if metrics, t, ok := r.snapshot.get(); ok {
+			for _, m := range metrics {
+				ch <- m
+			}
+			ch <- prometheus.MustNewConstMetric(lastScrapeTimestampDesc, prometheus.GaugeValue, float64(t.UnixNano())/1e9)
+			return
+		}
+	}
+
+	if *scrapeCacheTTL > 0 {
+		if metrics, ok := r.cache.get(); ok {
+			for _, m := range metrics {
+				ch <- m
+			}
+			return
+		}
+	}
+
+	// The scrape may outlive the caller, so it holds on to the collector
+	// it was started with even if the configuration is reloaded.
+	collector := r.collector
+	metrics, err := r.group.do(ctx, func(ctx context.Context) []prometheus.Metric {
+		metrics := collectMetrics(func(ch chan<- prometheus.Metric) {
+			collector.collect(ctx, ch)
+		})
+		// The partial metrics of canceled scrapes are not reused.
+		if *scrapeCacheTTL > 0 && ctx.Err() == nil {
+			r.cache.set(metrics)
+		}
+		r.collected()
+		return metrics
+	})
+	if err != nil {
+		log.Warnf("Scrape canceled before the metrics were collected: %s", err)
+		return
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// collected records that a scrape has finished.
+func (r *reloader) collected() {
+	r.lastCollectMu.Lock()
+	r.lastCollect = time.Now()
+	r.lastCollectMu.Unlock()
+}
+
+// gatherer returns a gatherer of the metrics of the targets, whose scrapes are
+// canceled when the context is done.
+func (r *reloader) gatherer(ctx context.Context) (prometheus.Gatherer, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(contextReloader{r, ctx}); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// contextReloader is a prometheus.Collector collecting the metrics of the
+// targets of the reloader with the context.
+type contextReloader struct {
+	*reloader
+	ctx context.Context
+}
+
+// Collect implements prometheus.Collector.
+func (r contextReloader) Collect(ch chan<- prometheus.Metric) {
+	r.collect(r.ctx, ch)
+}
+
+// ServeHTTP reloads the configuration on POST requests bearing the token.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := readToken(*reloadTokenFile)
+	if err != nil {
+		log.Errorf("Failed to read the reload token: %s", err)
+		http.Error(w, "Failed to read the reload token", http.StatusInternalServerError)
+		return
+	}
+	if !hasBearerToken(req, token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		log.Errorf("Failed to reload the configuration: %s", err)
+		http.Error(w, fmt.Sprintf("Failed to reload the configuration: %s", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,100 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes the configuration file of the test.
+func writeConfig(t *testing.T, filename, content string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloaderQueueFilters(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:queues", "low")
+
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, filename, fmt.Sprintf(`
+targets:
+  - url: %s
+queues:
+  include: ^default$
+`, r.url()))
+	restoreFlags(t)
+	setFlags(t, map[string]string{"config.file": filename})
+
+	reloader, err := newReloader(map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(reloader.close)
+
+	// The queue filters of the configuration apply from the start.
+	mfs := gather(t, reloader)
+	assertSample(t, mfs, "resque_queues", nil, 1)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertNoSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"})
+
+	// The queue filters of the new configuration apply after a reload.
+	writeConfig(t, filename, fmt.Sprintf(`
+targets:
+  - url: %s
+queues:
+  exclude: ^default$
+`, r.url()))
+	if err := reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs = gather(t, reloader)
+	assertSample(t, mfs, "resque_queues", nil, 2)
+	assertNoSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"})
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"}, 0)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "low"}, 0)
+}
+
+func TestReloaderKeepsConfigurationOnError(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, filename, fmt.Sprintf(`
+targets:
+  - url: %s
+queues:
+  include: ^default$
+`, r.url()))
+	restoreFlags(t)
+	setFlags(t, map[string]string{"config.file": filename})
+
+	reloader, err := newReloader(map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(reloader.close)
+
+	writeConfig(t, filename, `
+targets:
+  - url: invalid://localhost
+queues:
+  include: ^mailers$
+`)
+	if err := reloader.reload(); err == nil {
+		t.Fatal("expected an error for an invalid URL")
+	}
+	if *queueInclude != "^default$" {
+		t.Errorf("--queue.include = %q, want the previous value", *queueInclude)
+	}
+
+	mfs := gather(t, reloader)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertNoSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"})
+}
@@ -0,0 +1,237 @@
+package resqueexporter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	remoteWriteURL = Flags.String(
+		"remote-write.url",
+		"",
+		"URL of the Prometheus remote write endpoint to push the metrics to at the interval, in addition to serving them over HTTP.",
+	)
+	remoteWriteInterval = Flags.Duration(
+		"remote-write.interval",
+		time.Minute,
+		"Interval to push the metrics to the remote write endpoint at.",
+	)
+	remoteWriteUsername = Flags.String(
+		"remote-write.username",
+		"",
+		"Username for the basic authentication to the remote write endpoint.",
+	)
+	remoteWritePasswordFile = Flags.String(
+		"remote-write.password-file",
+		"",
+		"Path to the file containing the password for the basic authentication to the remote write endpoint.",
+	)
+	remoteWriteBearerTokenFile = Flags.String(
+		"remote-write.bearer-token-file",
+		"",
+		"Path to the file containing the bearer token to authenticate to the remote write endpoint.",
+	)
+	remoteWriteExternalLabels = newStringsValue()
+)
+
+func init() {
+	Flags.Var(remoteWriteExternalLabels, "remote-write.external-label", "Label in the form of name=value to add to the samples pushed to the remote write endpoint. Can be repeated.")
+}
+
+// remoteWriter pushes the metrics of the targets to a Prometheus remote write
+// endpoint.
+type remoteWriter struct {
+	url            string
+	client         *http.Client
+	externalLabels []labelPair
+}
+
+// timeSeries is a sample of a series in the remote write protocol.
+type timeSeries struct {
+	labels    []labelPair
+	value     float64
+	timestamp int64
+}
+
+// newRemoteWriter returns a remote writer configured by the flags.
+func newRemoteWriter() (*remoteWriter, error) {
+	if *remoteWritePasswordFile != "" && *remoteWriteBearerTokenFile != "" {
+		return nil, errors.New("--remote-write.password-file and --remote-write.bearer-token-file can't be used together")
+	}
+
+	w := &remoteWriter{
+		url:    *remoteWriteURL,
+		client: &http.Client{Timeout: *remoteWriteInterval},
+	}
+	for _, label := range remoteWriteExternalLabels.values {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || !model.LabelName(parts[0]).IsValid() {
+			return nil, fmt.Errorf("invalid external label: %s", label)
+		}
+		w.externalLabels = append(w.externalLabels, labelPair{parts[0], parts[1]})
+	}
+	return w, nil
+}
+
+// String implements sink.
+func (w *remoteWriter) String() string {
+	return redactURL(w.url)
+}
+
+// push implements sink.
+func (w *remoteWriter) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	series := w.timeSeries(mfs, time.Now())
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(snappyEncode(encodeWriteRequest(series))))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "resque_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if err := w.authenticate(req); err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// authenticate sets the credentials to the request. The files are read on
+// every push, so that the credentials can be rotated without restarting the
+// exporter.
+func (w *remoteWriter) authenticate(req *http.Request) error {
+	if *remoteWriteBearerTokenFile != "" {
+		token, err := ioutil.ReadFile(*remoteWriteBearerTokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	if *remoteWriteUsername != "" {
+		var password []byte
+		if *remoteWritePasswordFile != "" {
+			var err error
+			if password, err = ioutil.ReadFile(*remoteWritePasswordFile); err != nil {
+				return err
+			}
+		}
+		req.SetBasicAuth(*remoteWriteUsername, strings.TrimSpace(string(password)))
+	}
+	return nil
+}
+
+// timeSeries returns the samples of the metric families with the external
+// labels, sorted by name as required by the remote write protocol. The
+// external labels don't override the labels of the metrics.
+func (w *remoteWriter) timeSeries(mfs []*dto.MetricFamily, now time.Time) []timeSeries {
+	var series []timeSeries
+	for _, s := range samples(mfs, now) {
+		labels := []labelPair{{model.MetricNameLabel, s.name}}
+		labels = append(labels, s.labels...)
+		labels = append(labels, w.externalLabels...)
+		series = append(series, timeSeries{labels: sortLabels(labels), value: s.value, timestamp: s.timestamp})
+	}
+	return series
+}
+
+// encodeWriteRequest encodes the series in the protocol buffer of the
+// WriteRequest message of the remote write protocol.
+func encodeWriteRequest(series []timeSeries) []byte {
+	const (
+		writeRequestTimeseries = 1<<3 | proto.WireBytes
+		timeSeriesLabels       = 1<<3 | proto.WireBytes
+		timeSeriesSamples      = 2<<3 | proto.WireBytes
+		labelName              = 1<<3 | proto.WireBytes
+		labelValue             = 2<<3 | proto.WireBytes
+		sampleValue            = 1<<3 | proto.WireFixed64
+		sampleTimestamp        = 2<<3 | proto.WireVarint
+	)
+
+	req := proto.NewBuffer(nil)
+	for _, s := range series {
+		ts := proto.NewBuffer(nil)
+		for _, l := range s.labels {
+			label := proto.NewBuffer(nil)
+			label.EncodeVarint(labelName)
+			label.EncodeStringBytes(l.name)
+			label.EncodeVarint(labelValue)
+			label.EncodeStringBytes(l.value)
+			ts.EncodeVarint(timeSeriesLabels)
+			ts.EncodeRawBytes(label.Bytes())
+		}
+		sample := proto.NewBuffer(nil)
+		sample.EncodeVarint(sampleValue)
+		sample.EncodeFixed64(math.Float64bits(s.value))
+		sample.EncodeVarint(sampleTimestamp)
+		sample.EncodeVarint(uint64(s.timestamp))
+		ts.EncodeVarint(timeSeriesSamples)
+		ts.EncodeRawBytes(sample.Bytes())
+
+		req.EncodeVarint(writeRequestTimeseries)
+		req.EncodeRawBytes(ts.Bytes())
+	}
+	return req.Bytes()
+}
+
+// snappyEncode encodes the data in the snappy block format required by the
+// remote write protocol. The data are encoded as literals without
+// compression, which the snappy decoders accept as is.
+func snappyEncode(src []byte) []byte {
+	const maxLiteral = 1 << 16
+
+	b := proto.NewBuffer(nil)
+	b.EncodeVarint(uint64(len(src)))
+	dst := b.Bytes()
+	for len(src) > 0 {
+		n := len(src)
+		if n > maxLiteral {
+			n = maxLiteral
+		}
+		switch {
+		case n <= 60:
+			dst = append(dst, byte(n-1)<<2)
+		case n <= 1<<8:
+			dst = append(dst, 60<<2, byte(n-1))
+		default:
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
+
+// startRemoteWrite starts pushing the metrics of the targets to the remote
+// write endpoint given by --remote-write.url until the context is done.
+func startRemoteWrite(ctx context.Context, r *reloader) error {
+	w, err := newRemoteWriter()
+	if err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, w, *remoteWriteInterval)
+	return nil
+}
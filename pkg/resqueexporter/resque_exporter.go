@@ -0,0 +1,1624 @@
+package resqueexporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	namespace = "resque"
+)
+
+// Flags is the set of the flags configuring the exporter, which are parsed
+// from the command line by Main. Programs embedding the collector can set
+// them before calling NewCollector.
+var Flags = flag.NewFlagSet("resque_exporter", flag.ExitOnError)
+
+var (
+	collectQueueMemory = Flags.Bool(
+		"collector.queue-memory",
+		false,
+		"Collect the memory usage of queues. Requires Redis 4.0 or later.",
+	)
+	discoverNamespaces = Flags.Bool(
+		"redis.discover-namespaces",
+		false,
+		"Scrape every namespace found in the Redis, instead of the one given by --redis.namespace.",
+	)
+	redisClientName = Flags.String(
+		"redis.client-name",
+		"resque-exporter",
+		"Name set to the connections to the Redis with CLIENT SETNAME. Empty to leave them unnamed.",
+	)
+	redisDialTimeout = Flags.Duration(
+		"redis.dial-timeout",
+		5*time.Second,
+		"Timeout for establishing new connections to the Redis.",
+	)
+	redisKeySeparator = Flags.String(
+		"redis.key-separator",
+		":",
+		"Separator used by Resque to join the parts of its Redis keys.",
+	)
+	redisKeyTemplate = Flags.String(
+		"redis.key-template",
+		"",
+		"Template of the Redis keys, where {namespace} and {key} are replaced with the namespace and the key. Defaults to {namespace}<separator>{key}, or {key} without a namespace.",
+	)
+	redisMinIdleConns = Flags.Int(
+		"redis.min-idle-conns",
+		0,
+		"Minimum number of idle connections to the Redis to keep in the pool, up to the pool size. As the vendored go-redis has no MinIdleConns, the exporter opens them itself after each scrape so that the next one doesn't wait for new connections. Not supported with redis+cluster.",
+	)
+	redisNamespace = Flags.String(
+		"redis.namespace",
+		"resque",
+		"Namespace used by Resque to prefix all its Redis keys. Multiple namespaces can be given separated by commas.",
+	)
+	redisPoolSize = Flags.Int(
+		"redis.pool-size",
+		0,
+		"Maximum number of connections to the Redis. Defaults to 10 connections per CPU.",
+	)
+	redisReadTimeout = Flags.Duration(
+		"redis.read-timeout",
+		3*time.Second,
+		"Timeout for reading the replies of the Redis.",
+	)
+	redisPasswordFile = Flags.String(
+		"redis.password-file",
+		"",
+		"File containing the password to authenticate to the Redis. Re-read when connecting.",
+	)
+	redisReplicaURL = Flags.String(
+		"redis.replica-url",
+		"",
+		"URL to a replica of the Redis to run the scrape commands against instead of the Redis given by --redis.url.",
+	)
+	redisTLSCAFile = Flags.String(
+		"redis.tls.ca-file",
+		"",
+		"CA certificate file to verify the certificate of the Redis connected using TLS.",
+	)
+	redisTLSCertFile = Flags.String(
+		"redis.tls.cert-file",
+		"",
+		"Client certificate file to authenticate to the Redis connected using TLS.",
+	)
+	redisTLSInsecureSkipVerify = Flags.Bool(
+		"redis.tls.insecure-skip-verify",
+		false,
+		"Skip verifying the certificate of the Redis connected using TLS.",
+	)
+	redisTLSKeyFile = Flags.String(
+		"redis.tls.key-file",
+		"",
+		"Client private key file to authenticate to the Redis connected using TLS.",
+	)
+	redisURLs         = newStringsValue("redis://localhost:6379")
+	redisWriteTimeout = Flags.Duration(
+		"redis.write-timeout",
+		0,
+		"Timeout for writing commands to the Redis. Defaults to the read timeout.",
+	)
+	printVersion = Flags.Bool(
+		"version",
+		false,
+		"Print version information.",
+	)
+	disableExporterMetrics = Flags.Bool(
+		"web.disable-exporter-metrics",
+		false,
+		"Exclude the metrics about the exporter itself, e.g. go_*, process_* and http_*, from the telemetry.",
+	)
+	enableLifecycle = Flags.Bool(
+		"web.enable-lifecycle",
+		false,
+		"Enable shutting down the exporter by POST requests to /-/quit.",
+	)
+	enablePprof = Flags.Bool(
+		"web.enable-pprof",
+		false,
+		"Expose the profiling data of the exporter under /debug/pprof/.",
+	)
+	listenAddress = Flags.String(
+		"web.listen-address",
+		":9447",
+		"Address to listen on for web interface and telemetry, or the path to a Unix domain socket prefixed with unix://.",
+	)
+	routePrefix = Flags.String(
+		"web.route-prefix",
+		"/",
+		"Prefix of the paths of all the web endpoints, e.g. when served under a path by a reverse proxy.",
+	)
+	shutdownTimeout = Flags.Duration(
+		"web.shutdown-timeout",
+		30*time.Second,
+		"Maximum time to wait for the in-flight requests to finish on shutdown.",
+	)
+	metricPath = Flags.String(
+		"web.telemetry-path",
+		"/metrics",
+		"Path under which to expose metrics.",
+	)
+)
+
+var (
+	failedJobExecutionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "failed_job_executions_total"),
+		"Total number of failed job executions.",
+		nil, nil,
+	)
+	failedQueuesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "failed_queues"),
+		"Number of failed queues.",
+		nil, nil,
+	)
+	jobExecutionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_executions_total"),
+		"Total number of job executions.",
+		nil, nil,
+	)
+	jobsInFailedQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_in_failed_queue"),
+		"Number of jobs in a failed queue.",
+		[]string{"queue"}, nil,
+	)
+	jobsInQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_in_queue"),
+		"Number of jobs in a queue.",
+		[]string{"queue"}, nil,
+	)
+	jobsPendingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "jobs_pending_total"),
+		"Total number of jobs in all queues, excluding failed queues.",
+		nil, nil,
+	)
+	orphanQueuesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "orphan_queues"),
+		"Number of queues not registered in the set of queues.",
+		nil, nil,
+	)
+	queueBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "queue_bytes"),
+		"Number of bytes of memory used by a queue.",
+		[]string{"queue"}, nil,
+	)
+	queuesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "queues"),
+		"Number of queues.",
+		nil, nil,
+	)
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"),
+		"Time this scrape of resque metrics took.",
+		nil, nil,
+	)
+	scrapeCollectorDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
+		"Time a collector of this scrape of resque metrics took.",
+		[]string{"collector"}, nil,
+	)
+	scrapeCollectorSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_success"),
+		"Whether a collector of this scrape of resque metrics was successful.",
+		[]string{"collector"}, nil,
+	)
+	redisUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "redis", "up"),
+		"Whether the Redis responded to a PING in this scrape of resque metrics.",
+		nil, nil,
+	)
+	upDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Whether this scrape of resque metrics was successful.",
+		nil, nil,
+	)
+	workersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "workers"),
+		"Number of workers.",
+		nil, nil,
+	)
+	workingWorkersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "working_workers"),
+		"Number of working workers.",
+		nil, nil,
+	)
+)
+
+// Collector collects Resque metrics. It implements prometheus.Collector.
+type Collector struct {
+	redisClient     redisCmdable
+	redisEndpoints  *endpoints
+	redisNamespace  string
+	redisNamespaces []string
+
+	filter  *queueFilter
+	timeout time.Duration
+	// minIdleConns is the number of idle connections the pool is warmed
+	// with after the scrapes.
+	minIdleConns int
+	logger       log.FieldLogger
+	constLabels  prometheus.Labels
+
+	// ctx cancels the current scrape, and is nil if the scrape can't be
+	// canceled.
+	ctx context.Context
+
+	// rawLabels disables the rewriting, the limit and the sanitization of
+	// the label values, e.g. to get the stats of the actual queues.
+	rawLabels bool
+
+	// trace records the timings of the current scrape if it can be slow
+	// logged, and is nil otherwise.
+	trace *scrapeTrace
+
+	backoff *backoff
+
+	// keyspace counts the jobs enqueued and dequeued if
+	// --collector.keyspace-notifications is enabled.
+	keyspace *keyspaceTracker
+
+	failedScrapes        prometheus.Counter
+	sanitizedLabelValues prometheus.Counter
+	scrapeErrors         *prometheus.CounterVec
+	scrapes              prometheus.Counter
+	skippedKeys          *prometheus.CounterVec
+	truncatedMetrics     prometheus.Counter
+}
+
+// NewCollector returns a new collector of Resque metrics configured by the
+// options.
+func NewCollector(opts ...Option) (*Collector, error) {
+	o := newOptions(opts)
+
+	var redisEndpoints *endpoints
+	if o.redisClient != nil {
+		redisEndpoints = newClientEndpoints(o.redisClient)
+	} else {
+		var err error
+		redisEndpoints, err = newEndpoints(append([]string{o.redisURL}, redisFallbackURLs.values...))
+		if err != nil {
+			return nil, err
+		}
+	}
+	redisClient, _ := redisEndpoints.get()
+
+	if err := redisEndpoints.checkMinIdleConns(*redisMinIdleConns); err != nil {
+		return nil, err
+	}
+
+	filter, err := newQueueFilter(o.queueInclude, o.queueExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue filter: %s", err)
+	}
+
+	redisNamespace := o.redisNamespace
+	var redisNamespaces []string
+	if strings.Contains(redisNamespace, ",") {
+		redisNamespaces = strings.Split(redisNamespace, ",")
+	}
+
+	return &Collector{
+		redisClient:     redisClient,
+		redisEndpoints:  redisEndpoints,
+		redisNamespace:  redisNamespace,
+		redisNamespaces: redisNamespaces,
+		filter:          filter,
+		timeout:         o.timeout,
+		minIdleConns:    *redisMinIdleConns,
+		logger:          o.logger,
+		constLabels:     o.constLabels,
+		backoff:         newBackoff(*redisReconnectBackoffMin, *redisReconnectBackoffMax),
+		keyspace:        newKeyspaceTracker(),
+		failedScrapes: newCreatedCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_scrapes_total",
+			Help:      "Total number of failed scrapes.",
+		}),
+		sanitizedLabelValues: newCreatedCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "sanitized_label_values_total",
+			Help:      "Total number of the label values escaped because they are not valid UTF-8 or contain control characters or backslashes.",
+		}),
+		scrapeErrors: newCreatedCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scrape",
+			Name:      "errors_total",
+			Help:      "Total number of errors of a collector of the scrapes.",
+		}, []string{"collector"}),
+		scrapes: newCreatedCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scrapes_total",
+			Help:      "Total number of scrapes.",
+		}),
+		skippedKeys: newCreatedCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "scrape",
+			Name:      "skipped_keys_total",
+			Help:      "Total number of the Redis keys skipped by the scrapes because of their types or values.",
+		}, []string{"reason"}),
+		truncatedMetrics: newCreatedCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "metrics_truncated_total",
+			Help:      "Total number of series summed into the series labeled _other by the label limit.",
+		}),
+	}, nil
+}
+
+// connOptions holds the options of the connections to Redis common to all
+// kinds of clients.
+type connOptions struct {
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	poolSize     int
+	clientName   string
+}
+
+// newConnOptions returns the options given by the flags, overridden by the
+// query parameters of the Redis URL.
+func newConnOptions(u *url.URL) (connOptions, error) {
+	conn := connOptions{
+		dialTimeout:  *redisDialTimeout,
+		readTimeout:  *redisReadTimeout,
+		writeTimeout: *redisWriteTimeout,
+		poolSize:     *redisPoolSize,
+		clientName:   *redisClientName,
+	}
+
+	q := u.Query()
+	for name, d := range map[string]*time.Duration{
+		"dial_timeout":  &conn.dialTimeout,
+		"read_timeout":  &conn.readTimeout,
+		"write_timeout": &conn.writeTimeout,
+	} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		// A timeout without a unit is in seconds.
+		if seconds, err := strconv.Atoi(v); err == nil {
+			*d = time.Duration(seconds) * time.Second
+		} else if *d, err = time.ParseDuration(v); err != nil {
+			return conn, fmt.Errorf("invalid %s: %s", name, v)
+		}
+	}
+	if v := q.Get("pool_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return conn, fmt.Errorf("invalid pool_size: %s", v)
+		}
+		conn.poolSize = n
+	}
+	if _, ok := q["client_name"]; ok {
+		conn.clientName = q.Get("client_name")
+	}
+
+	return conn, nil
+}
+
+func newRedisClient(redisURL string) (redis.UniversalClient, error) {
+	var options redis.Options
+
+	u, err := parseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := newConnOptions(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "redis+cluster" {
+		return newClusterClient(u, conn), nil
+	}
+
+	if u.Scheme == "redis+sentinel" {
+		return newFailoverClient(u, conn)
+	}
+
+	if u.Scheme == "redis" || u.Scheme == "rediss" || u.Scheme == "tcp" {
+		options.Network = "tcp"
+		options.Addr = net.JoinHostPort(u.Hostname(), u.Port())
+		if len(u.Path) > 1 {
+			if db, err := strconv.Atoi(u.Path[1:]); err == nil {
+				options.DB = db
+			}
+		}
+		if u.Scheme == "rediss" {
+			if options.TLSConfig, err = newTLSConfig(u.Hostname()); err != nil {
+				return nil, err
+			}
+		}
+	} else if u.Scheme == "srv" {
+		options.Addr = u.Hostname()
+		options.Dialer = srvDialer(u.Hostname(), conn.dialTimeout)
+		if len(u.Path) > 1 {
+			if db, err := strconv.Atoi(u.Path[1:]); err == nil {
+				options.DB = db
+			}
+		}
+	} else if u.Scheme == "unix" {
+		options.Network = "unix"
+		options.Addr = u.Path
+	} else {
+		return nil, fmt.Errorf("unknown URL scheme: %s", u.Scheme)
+	}
+
+	options.Password, options.DB, options.OnConnect = initConn(u, options.DB, conn)
+
+	options.DialTimeout = conn.dialTimeout
+	options.ReadTimeout = conn.readTimeout
+	options.WriteTimeout = conn.writeTimeout
+	options.PoolSize = conn.poolSize
+
+	return redis.NewClient(&options), nil
+}
+
+// newClusterClient returns a client connecting to Redis Cluster. The URL looks
+// like redis+cluster://[:password@]host:port[,host:port...].
+func newClusterClient(u *url.URL, conn connOptions) *redis.ClusterClient {
+	var options redis.ClusterOptions
+
+	options.Addrs = strings.Split(u.Host, ",")
+
+	options.Password, _, options.OnConnect = initConn(u, 0, conn)
+
+	options.DialTimeout = conn.dialTimeout
+	options.ReadTimeout = conn.readTimeout
+	options.WriteTimeout = conn.writeTimeout
+	options.PoolSize = conn.poolSize
+
+	return redis.NewClusterClient(&options)
+}
+
+// newFailoverClient returns a client connecting to the master monitored by
+// Redis Sentinel. The URL looks like
+// redis+sentinel://[:password@]host:port[,host:port...]/master[/db].
+func newFailoverClient(u *url.URL, conn connOptions) (*redis.Client, error) {
+	var options redis.FailoverOptions
+
+	options.SentinelAddrs = strings.Split(u.Host, ",")
+
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if path[0] == "" {
+		return nil, fmt.Errorf("no master name in URL: %s", u.Path)
+	}
+	options.MasterName = path[0]
+	if len(path) > 1 {
+		if db, err := strconv.Atoi(path[1]); err == nil {
+			options.DB = db
+		}
+	}
+
+	options.Password, options.DB, options.OnConnect = initConn(u, options.DB, conn)
+
+	options.DialTimeout = conn.dialTimeout
+	options.ReadTimeout = conn.readTimeout
+	options.WriteTimeout = conn.writeTimeout
+	options.PoolSize = conn.poolSize
+
+	return redis.NewFailoverClient(&options), nil
+}
+
+// initConn returns the password and the database go-redis initializes new
+// connections with, and a hook initializing them further. go-redis only sends
+// AUTH with a password given upfront, and selects the database right after
+// that, so the hook authenticates Redis 6 ACL users and passwords read from a
+// file, and selects the database by itself. It also sets the client name.
+func initConn(u *url.URL, db int, conn connOptions) (string, int, func(*redis.Conn) error) {
+	username := u.User.Username()
+	if v := os.Getenv("REDIS_USERNAME"); len(v) > 0 {
+		username = v
+	}
+	password, ok := u.User.Password()
+	if v := os.Getenv("REDIS_PASSWORD"); len(v) > 0 {
+		password, ok = v, true
+	}
+	auth := *redisPasswordFile != "" || ok && username != ""
+
+	if !auth && conn.clientName == "" {
+		return password, db, nil
+	}
+
+	hook := func(cn *redis.Conn) error {
+		if auth {
+			password := password
+			if *redisPasswordFile != "" {
+				// The file is read on every new connection so that
+				// rotated passwords are picked up when reconnecting.
+				b, err := ioutil.ReadFile(*redisPasswordFile)
+				if err != nil {
+					return err
+				}
+				password = strings.TrimRight(string(b), "\r\n")
+			}
+
+			args := []interface{}{"auth", password}
+			if username != "" {
+				args = []interface{}{"auth", username, password}
+			}
+			if err := cn.Process(redis.NewStatusCmd(args...)); err != nil {
+				return err
+			}
+
+			if db > 0 {
+				if err := cn.Select(db).Err(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if conn.clientName != "" {
+			// The name is only informational, so the connection is
+			// used even if CLIENT is not allowed, e.g. by managed Redis.
+			if err := cn.Process(redis.NewStatusCmd("client", "setname", conn.clientName)); err != nil {
+				if isConnectionError(err) {
+					return err
+				}
+				log.Debugf("Failed to set the client name: %s", err)
+			}
+		}
+		return nil
+	}
+
+	if auth {
+		return "", 0, hook
+	}
+	return password, db, hook
+}
+
+func newTLSConfig(serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: *redisTLSInsecureSkipVerify,
+	}
+
+	if *redisTLSCAFile != "" {
+		ca, err := ioutil.ReadFile(*redisTLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", *redisTLSCAFile)
+		}
+	}
+
+	if *redisTLSCertFile != "" || *redisTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(*redisTLSCertFile, *redisTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Describe implements prometheus.Collector.
+func (e *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deadWorkersDesc
+	ch <- delayedJobsDesc
+	ch <- failedJobExecutionsDesc
+	ch <- failedQueuesDesc
+	ch <- jobExecutionsDesc
+	ch <- jobsInFailedQueueDesc
+	ch <- jobsInQueueDesc
+	ch <- jobsPendingDesc
+	ch <- orphanQueuesDesc
+	ch <- queueBytesDesc
+	ch <- queuesDesc
+	ch <- scrapeDurationDesc
+	ch <- scrapeCollectorDurationDesc
+	ch <- scrapeCollectorSuccessDesc
+	ch <- redisUpDesc
+	ch <- upDesc
+	ch <- redisEndpointDesc
+	ch <- workersDesc
+	ch <- workingWorkersDesc
+
+	ch <- busAppsDesc
+	ch <- busIncomingJobsDesc
+	ch <- busSubscriptionsDesc
+	ch <- jobLocksDesc
+	ch <- jobsDequeuedDesc
+	ch <- jobsEnqueuedDesc
+	ch <- jobStatsAverageDurationDesc
+	ch <- jobStatsEnqueuedDesc
+	ch <- jobStatsFailedDesc
+	ch <- jobStatsPerformedDesc
+	ch <- jobClassDurationDesc
+	ch <- jobDurationDesc
+	ch <- queueEligibleWorkersDesc
+	ch <- workerPatternQueuesDesc
+	ch <- queueThrottledDesc
+	ch <- throttlerBucketJobsDesc
+	ch <- throttlerLimitDesc
+
+	describePoolStats(ch)
+	e.backoff.Describe(ch)
+	ch <- e.failedScrapes.Desc()
+	ch <- e.sanitizedLabelValues.Desc()
+	e.scrapeErrors.Describe(ch)
+	ch <- e.scrapes.Desc()
+	e.skippedKeys.Describe(ch)
+	ch <- e.truncatedMetrics.Desc()
+}
+
+// Collect implements prometheus.Collector.
+func (e *Collector) Collect(ch chan<- prometheus.Metric) {
+	e.collect(context.Background(), ch)
+}
+
+// collect collects the metrics, canceling the scrape of Redis when the
+// context is done.
+func (e *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	if len(e.constLabels) > 0 {
+		labeledCh, done := withLabels(ch, e.constLabels)
+		defer done()
+		ch = labeledCh
+	}
+
+	redisClient, redisURL := e.redisEndpoints.get()
+	ch <- prometheus.MustNewConstMetric(redisEndpointDesc, prometheus.GaugeValue, 1, redisURL)
+
+	var redisUp float64
+	if !e.backoff.allow() {
+		e.logger.Debug("Waiting to reconnect to Redis")
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+	} else {
+		e.scrapes.Inc()
+
+		// A PING tells an unreachable Redis from the problems of the
+		// data of Resque, and saves the scrape failing anyway.
+		err := contextClient(ctx, redisClient).Ping().Err()
+		if err == nil {
+			redisUp = 1
+			err = e.scrapeContext(ctx, redisClient, ch)
+		}
+		if err != nil {
+			if isConnectionError(err) {
+				e.redisEndpoints.failover(redisClient)
+			}
+			e.backoff.update(err)
+			e.failedScrapes.Inc()
+			e.logger.Error(err)
+			ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+		} else {
+			e.backoff.update(nil)
+			ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+		}
+		if redisUp == 1 && e.minIdleConns > 0 {
+			go e.redisEndpoints.warmPool(redisClient, e.minIdleConns)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(redisUpDesc, prometheus.GaugeValue, redisUp)
+
+	collectPoolStats(ch, redisClient)
+	e.backoff.Collect(ch)
+	ch <- e.failedScrapes
+	ch <- e.sanitizedLabelValues
+	e.scrapeErrors.Collect(ch)
+	ch <- e.scrapes
+	e.skippedKeys.Collect(ch)
+	ch <- e.truncatedMetrics
+}
+
+func (e *Collector) scrape(ch chan<- prometheus.Metric) error {
+	if !e.rawLabels {
+		if *scrapeLabelLimit > 0 {
+			limitedCh, done := limitLabels(ch, *scrapeLabelLimit)
+			defer func() {
+				e.truncatedMetrics.Add(float64(done()))
+			}()
+			ch = limitedCh
+		}
+		if len(queueRewriteRules) > 0 {
+			rewrittenCh, done := rewriteLabels(ch, queueRewriteRules)
+			defer done()
+			ch = rewrittenCh
+		}
+		sanitizedCh, done := sanitizeLabels(ch)
+		defer func() {
+			e.sanitizedLabelValues.Add(float64(done()))
+		}()
+		ch = sanitizedCh
+	}
+
+	defer func(start time.Time) {
+		ch <- prometheus.MustNewConstMetric(
+			scrapeDurationDesc,
+			prometheus.GaugeValue,
+			float64(time.Since(start).Seconds()))
+	}(time.Now())
+
+	namespaces := e.redisNamespaces
+	if *discoverNamespaces {
+		if err := e.begin("namespaces"); err != nil {
+			return err
+		}
+		var err error
+		namespaces, err = e.namespaces()
+		e.trace.end()
+		if err != nil {
+			return err
+		}
+	} else if namespaces == nil {
+		return e.scrapeNamespace(ch)
+	}
+
+	var firstErr error
+	for _, ns := range namespaces {
+		namespaceCh, done := withLabels(ch, prometheus.Labels{"namespace": ns})
+		err := e.withNamespace(ns).scrapeNamespace(namespaceCh)
+		done()
+		if err != nil {
+			if isConnectionError(err) || e.canceled() != nil {
+				return err
+			}
+			if firstErr == nil {
+				firstErr = err
+			} else {
+				e.logger.Error(err)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// namespaces returns the namespaces having the set of queues.
+func (e *Collector) namespaces() ([]string, error) {
+	key := strings.SplitN(e.withNamespace("\x00").redisKey("queues"), "\x00", 2)
+	pattern := keyPattern{prefix: key[0], suffix: key[1]}
+
+	var namespaces []string
+	err := e.scanKeys(pattern.String(), func(key string) error {
+		ns, ok := pattern.Match(key)
+		if !ok {
+			return nil
+		}
+		typ, err := e.redisClient.Type(key).Result()
+		if err != nil {
+			return err
+		}
+		if typ == "set" {
+			namespaces = append(namespaces, ns)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// Close closes the connections to Redis.
+func (e *Collector) Close() {
+	e.keyspace.close()
+	e.redisEndpoints.close()
+}
+
+// withClient returns a copy of the exporter accessing Redis with the given
+// client.
+func (e *Collector) withClient(client redis.UniversalClient) *Collector {
+	c := *e
+	c.redisClient = client
+	return &c
+}
+
+// withRawLabels returns a copy of the exporter whose scrapes export the label
+// values as they are in Redis.
+func (e *Collector) withRawLabels() *Collector {
+	c := *e
+	c.rawLabels = true
+	return &c
+}
+
+// withNamespace returns a copy of the exporter building the Redis keys with
+// the given namespace.
+func (e *Collector) withNamespace(ns string) *Collector {
+	c := *e
+	c.redisNamespace = ns
+	return &c
+}
+
+// scrapeNamespace scrapes the metrics of the namespace. The collectors run
+// independently of each other, so that the metrics of the ones succeeding are
+// exported even if others fail, unless Redis is not reachable or the scrape is
+// canceled. The error of the first collector failing is returned.
+func (e *Collector) scrapeNamespace(ch chan<- prometheus.Metric) error {
+	defer e.trace.end()
+
+	s := newScrapeState(e.filter)
+
+	var firstErr error
+	for _, c := range enabledCollectors() {
+		if err := e.begin(c.name); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := c.scrape(e, s, ch)
+		ch <- prometheus.MustNewConstMetric(scrapeCollectorDurationDesc, prometheus.GaugeValue, time.Since(start).Seconds(), c.name)
+		if err == nil {
+			ch <- prometheus.MustNewConstMetric(scrapeCollectorSuccessDesc, prometheus.GaugeValue, 1, c.name)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(scrapeCollectorSuccessDesc, prometheus.GaugeValue, 0, c.name)
+		e.scrapeErrors.WithLabelValues(c.name).Inc()
+
+		err = &collectorError{collector: c.name, err: err}
+		if isConnectionError(err) {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		} else {
+			e.logger.Error(err)
+		}
+	}
+
+	return firstErr
+}
+
+var (
+	errQueuesNotCollected  = errors.New("the queues are not collected")
+	errWorkersNotCollected = errors.New("the workers are not collected")
+)
+
+// collectorError is an error of a collector of a scrape.
+type collectorError struct {
+	collector string
+	err       error
+}
+
+func (e *collectorError) Error() string {
+	return fmt.Sprintf("collector %s: %s", e.collector, e.err)
+}
+
+// The reasons the keys are skipped by the scrapes.
+const (
+	skipWrongType    = "wrong_type"
+	skipInvalidJSON  = "invalid_json"
+	skipInvalidValue = "invalid_value"
+)
+
+// skipKey counts the key skipped by the scrape for the reason instead of
+// failing the scrape, e.g. a queue overwritten with a value other than a list.
+func (e *Collector) skipKey(key, reason string, err error) {
+	e.skippedKeys.WithLabelValues(reason).Inc()
+	e.logger.Debugf("Skipped the key %s: %s", key, err)
+}
+
+// isWrongTypeError reports whether the error is a reply of Redis to a command
+// against a key holding a value of another type.
+func isWrongTypeError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+func (e *Collector) scrapeStats(ch chan<- prometheus.Metric) error {
+	stats, err := e.stats("processed", "failed")
+	if err != nil {
+		return err
+	}
+	if processed, ok := stats["processed"]; ok {
+		ch <- prometheus.MustNewConstMetric(jobExecutionsDesc, prometheus.CounterValue, processed)
+	}
+	if failed, ok := stats["failed"]; ok {
+		ch <- prometheus.MustNewConstMetric(failedJobExecutionsDesc, prometheus.CounterValue, failed)
+	}
+
+	return nil
+}
+
+// scrapeQueues exports the metrics of the queues matching the filter, and
+// returns all the queues.
+func (e *Collector) scrapeQueues(ch chan<- prometheus.Metric, filter *queueFilter) ([]string, error) {
+	allQueues, err := e.setMembers(e.redisKey("queues"))
+	if err != nil {
+		return nil, err
+	}
+	queues := filter.filter(allQueues)
+	ch <- prometheus.MustNewConstMetric(queuesDesc, prometheus.GaugeValue, float64(len(queues)))
+	// The static queues missing from the set are reported with the length
+	// of their lists, which is 0 if they don't exist.
+	queues = withStaticQueues(queues)
+
+	queueKeys := make([]string, len(queues))
+	for i, queue := range queues {
+		queueKeys[i] = e.redisKey("queue", queue)
+	}
+	queueJobs, err := e.listLengths(queueKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var pendingJobs int64
+	for i, queue := range queues {
+		jobs := queueJobs[i]
+		if jobs < 0 {
+			continue
+		}
+		pendingJobs += jobs
+		ch <- prometheus.MustNewConstMetric(jobsInQueueDesc, prometheus.GaugeValue, float64(jobs), queue)
+	}
+	ch <- prometheus.MustNewConstMetric(jobsPendingDesc, prometheus.GaugeValue, float64(pendingJobs))
+
+	if *collectQueueMemory {
+		queueBytes := make([]int64, len(queues))
+		err := parallel(len(queues), func(i int) error {
+			var err error
+			queueBytes[i], err = e.memoryUsage(queueKeys[i])
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, queue := range queues {
+			ch <- prometheus.MustNewConstMetric(queueBytesDesc, prometheus.GaugeValue, float64(queueBytes[i]), queue)
+		}
+	}
+
+	return allQueues, nil
+}
+
+func (e *Collector) scrapeFailedQueues(ch chan<- prometheus.Metric, filter *queueFilter) error {
+	failedQueues, err := e.failedQueues()
+	if err != nil {
+		return err
+	}
+	failedQueues = filter.filter(failedQueues)
+	ch <- prometheus.MustNewConstMetric(failedQueuesDesc, prometheus.GaugeValue, float64(len(failedQueues)))
+
+	failedQueueKeys := make([]string, len(failedQueues))
+	for i, queue := range failedQueues {
+		failedQueueKeys[i] = e.redisKey(queue)
+	}
+	failedQueueJobs, err := e.listLengths(failedQueueKeys)
+	if err != nil {
+		return err
+	}
+	for i, queue := range failedQueues {
+		if failedQueueJobs[i] < 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(jobsInFailedQueueDesc, prometheus.GaugeValue, float64(failedQueueJobs[i]), queue)
+	}
+
+	return nil
+}
+
+// failedQueues returns the failed queues of the multiple failure backends of
+// Resque, or the failed queue of the default backend if it exists.
+func (e *Collector) failedQueues() ([]string, error) {
+	failedQueues, err := e.setMembers(e.redisKey("failed_queues"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(failedQueues) == 0 {
+		exists, err := e.redisClient.Exists(e.redisKey("failed")).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 1 {
+			failedQueues = []string{"failed"}
+		}
+	}
+	return failedQueues, nil
+}
+
+// scrapeWorkers exports the metrics of the workers, and returns the live
+// workers.
+func (e *Collector) scrapeWorkers(ch chan<- prometheus.Metric) ([]string, error) {
+	workers, err := e.setMembers(e.redisKey("workers"))
+	if err != nil {
+		return nil, err
+	}
+
+	deadWorkers, err := e.deadWorkers(workers)
+	if err != nil {
+		return nil, err
+	}
+	if deadWorkers != nil {
+		var liveWorkers []string
+		for _, worker := range workers {
+			if !deadWorkers[worker] {
+				liveWorkers = append(liveWorkers, worker)
+			}
+		}
+		workers = liveWorkers
+		ch <- prometheus.MustNewConstMetric(deadWorkersDesc, prometheus.GaugeValue, float64(len(deadWorkers)))
+	}
+	ch <- prometheus.MustNewConstMetric(workersDesc, prometheus.GaugeValue, float64(len(workers)))
+
+	workerKeys := make([]string, len(workers))
+	for i, worker := range workers {
+		workerKeys[i] = e.redisKey("worker", worker)
+	}
+	workingWorkers, err := e.countExisting(workerKeys)
+	if err != nil {
+		return nil, err
+	}
+	ch <- prometheus.MustNewConstMetric(workingWorkersDesc, prometheus.GaugeValue, float64(workingWorkers))
+
+	return workers, nil
+}
+
+// scrapeOrphanQueues counts the queue lists that are not members of
+// the set of queues. Workers never reserve jobs from such queues.
+func (e *Collector) scrapeOrphanQueues(ch chan<- prometheus.Metric, queues []string) error {
+	registered := make(map[string]bool, len(queues))
+	for _, queue := range queues {
+		registered[e.redisKey("queue", queue)] = true
+	}
+
+	var orphanQueues int
+	err := e.scanKeys(e.redisKeyPattern("queue", "*").String(), func(key string) error {
+		if registered[key] {
+			return nil
+		}
+		typ, err := e.redisClient.Type(key).Result()
+		if err != nil {
+			return err
+		}
+		if typ == "list" {
+			orphanQueues++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(orphanQueuesDesc, prometheus.GaugeValue, float64(orphanQueues))
+
+	return nil
+}
+
+func (e *Collector) redisKey(a ...string) string {
+	key := strings.Join(a, *redisKeySeparator)
+	if *redisKeyTemplate != "" {
+		return strings.NewReplacer("{namespace}", e.redisNamespace, "{key}", key).Replace(*redisKeyTemplate)
+	}
+	if e.redisNamespace == "" {
+		return key
+	}
+	return e.redisNamespace + *redisKeySeparator + key
+}
+
+// keyPattern is a pattern matching the Redis keys built from parts one of
+// which contains a "*" wildcard.
+type keyPattern struct {
+	prefix, suffix string
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (e *Collector) redisKeyPattern(a ...string) keyPattern {
+	parts := make([]string, len(a))
+	for i, part := range a {
+		parts[i] = strings.Replace(part, "*", "\x00", 1)
+	}
+	key := strings.SplitN(e.redisKey(parts...), "\x00", 2)
+	return keyPattern{prefix: key[0], suffix: key[1]}
+}
+
+// String returns the glob-style pattern of the keys.
+func (p keyPattern) String() string {
+	return globEscaper.Replace(p.prefix) + "*" + globEscaper.Replace(p.suffix)
+}
+
+// Key returns the key whose wildcard is replaced with name.
+func (p keyPattern) Key(name string) string {
+	return p.prefix + name + p.suffix
+}
+
+// Match returns the part of the key matched by the wildcard.
+func (p keyPattern) Match(key string) (string, bool) {
+	if len(key) < len(p.prefix)+len(p.suffix) || !strings.HasPrefix(key, p.prefix) || !strings.HasSuffix(key, p.suffix) {
+		return "", false
+	}
+	return key[len(p.prefix) : len(key)-len(p.suffix)], true
+}
+
+// listLengths returns the lengths of the lists, getting them in pipelines.
+// The length of a key skipped because it is not a list is -1.
+func (e *Collector) listLengths(keys []string) ([]int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	err := e.pipelined(len(keys), func(pipe redis.Pipeliner, i int) {
+		cmds[i] = pipe.LLen(keys[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make([]int64, len(keys))
+	for i, cmd := range cmds {
+		if err := cmd.Err(); isWrongTypeError(err) {
+			e.skipKey(keys[i], skipWrongType, err)
+			lengths[i] = -1
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		lengths[i] = cmd.Val()
+	}
+	return lengths, nil
+}
+
+// existsBatchSize is the maximum number of keys checked by a single EXISTS.
+const existsBatchSize = 1000
+
+// countExisting returns the number of the keys that exist, checking them with
+// variadic EXISTS commands in pipelines.
+func (e *Collector) countExisting(keys []string) (int64, error) {
+	// The keys of a command have to be in the same hash slot with Redis
+	// Cluster, so each key is checked by its own command.
+	size := existsBatchSize
+	if _, ok := e.redisClient.(*redis.ClusterClient); ok {
+		size = 1
+	}
+
+	var batches [][]string
+	for len(keys) > 0 {
+		n := size
+		if n > len(keys) {
+			n = len(keys)
+		}
+		batches = append(batches, keys[:n])
+		keys = keys[n:]
+	}
+
+	cmds := make([]*redis.IntCmd, len(batches))
+	err := e.pipelined(len(batches), func(pipe redis.Pipeliner, i int) {
+		cmds[i] = pipe.Exists(batches[i]...)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, nil
+}
+
+// memoryUsage returns the number of bytes used by the key, or 0 if the key
+// does not exist.
+func (e *Collector) memoryUsage(key string) (int64, error) {
+	// The key of MEMORY USAGE is not known to Redis Cluster clients, so the
+	// command can't be routed to the node serving it.
+	if c, ok := e.redisClient.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		var total int64
+		err := c.ForEachMaster(func(client *redis.Client) error {
+			bytes, err := memoryUsage(client, key)
+			mu.Lock()
+			total += bytes
+			mu.Unlock()
+			return err
+		})
+		return total, err
+	}
+	return memoryUsage(e.redisClient, key)
+}
+
+func memoryUsage(client redisCmdable, key string) (int64, error) {
+	cmd := redis.NewIntCmd("memory", "usage", key)
+	client.Process(cmd)
+	bytes, err := cmd.Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return bytes, err
+}
+
+// scanKeys calls fn for each key matching the pattern, iterating the
+// keyspace with SCAN instead of blocking Redis with KEYS. With Redis Cluster,
+// the keyspace of every master is scanned.
+func (e *Collector) scanKeys(pattern string, fn func(key string) error) error {
+	c, ok := e.redisClient.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(e.redisClient, pattern, fn)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := c.ForEachMaster(func(client *redis.Client) error {
+		return scanKeys(client, pattern, func(key string) error {
+			mu.Lock()
+			keys = append(keys, key)
+			mu.Unlock()
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMembers returns the members of the set, iterating it with SSCAN instead
+// of blocking Redis with SMEMBERS on large sets. The members returned more
+// than once by SSCAN, e.g. while the set is rehashed, are returned once.
+func (e *Collector) setMembers(key string) ([]string, error) {
+	seen := make(map[string]bool)
+	var members []string
+	iter := e.redisClient.SScan(key, 0, "", 1000).Iterator()
+	for iter.Next() {
+		if member := iter.Val(); !seen[member] {
+			seen[member] = true
+			members = append(members, member)
+		}
+	}
+	return members, iter.Err()
+}
+
+func scanKeys(client redisCmdable, pattern string, fn func(key string) error) error {
+	iter := client.Scan(0, pattern, 1000).Iterator()
+	for iter.Next() {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func init() {
+	Flags.Var(redisURLs, "redis.url", "URL to the Redis backing the Resque. Can be repeated to scrape multiple Redis.")
+
+	registerCoreCollector("stats", true, "Collect the numbers of processed and failed jobs.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeStats(ch)
+	})
+	registerCoreCollector("queues", true, "Collect the numbers of jobs in queues.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		s.queues, s.queuesErr = e.scrapeQueues(ch, s.filter)
+		return s.queuesErr
+	})
+	registerCoreCollector("failed-queues", true, "Collect the numbers of jobs in failed queues.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeFailedQueues(ch, s.filter)
+	})
+	registerCoreCollector("workers", true, "Collect the numbers of workers.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		s.workers, s.workersErr = e.scrapeWorkers(ch)
+		return s.workersErr
+	})
+	registerCollector("orphan-queues", false, "Collect the number of queues missing from the set of queues. Scans the whole keyspace.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		if s.queuesErr != nil {
+			return errQueuesNotCollected
+		}
+		return e.scrapeOrphanQueues(ch, s.queues)
+	})
+}
+
+// Main runs the exporter with the flags given on the command line.
+func Main() {
+	// The subcommands are given before the flags, e.g. resque_exporter
+	// dump --redis.url=redis://localhost:6379.
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && (args[0] == "dump" || args[0] == "bench") {
+		command, args = args[0], args[1:]
+	}
+	Flags.Parse(args)
+	if err := setFlagsFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupLogging(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *printVersion {
+		fmt.Println(version.Print("resque_exporter"))
+		return
+	}
+
+	switch command {
+	case "dump":
+		if err := runDump(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "bench":
+		if err := runBench(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.Infoln("Starting resque_exporter", version.Info())
+	log.Infoln("Build context", version.BuildContext())
+
+	if *disableExporterMetrics {
+		prometheus.Unregister(prometheus.NewProcessCollector(os.Getpid(), ""))
+		prometheus.Unregister(prometheus.NewGoCollector())
+	} else {
+		prometheus.MustRegister(version.NewCollector("resque_exporter"))
+		prometheus.MustRegister(redisCommands, redisCommandDuration)
+	}
+
+	reloader, err := newReloader(explicitFlags())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+
+	// The configuration has been validated by loading it.
+	if *checkConfig {
+		if _, err := newServer(*listenAddress, mux); err != nil {
+			log.Fatal(err)
+		}
+		if *checkConfigConnect {
+			if err := reloader.check(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Println("The configuration is valid")
+		return
+	}
+
+	if *runOnce {
+		if err := reloader.scrapeOnce(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.reload(); err != nil {
+				log.Errorf("Failed to reload the configuration: %s", err)
+			}
+		}
+	}()
+
+	if *redisSecretCheckInterval > 0 && len(secretFiles()) > 0 {
+		go reloader.watchSecretFiles(*redisSecretCheckInterval)
+	}
+
+	if *textfilePath != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+		go func() {
+			log.Infof("Received %s, shutting down", <-term)
+			cancel()
+		}()
+		reloader.writeTextfileEvery(ctx, *textfilePath, *textfileInterval)
+		reloader.close()
+		return
+	}
+
+	if *reloadTokenFile != "" {
+		mux.Handle("/-/reload", reloader)
+	}
+	quit := make(chan struct{}, 1)
+	if *enableLifecycle {
+		mux.Handle("/-/quit", quitHandler(quit))
+	}
+	if *enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if *peekTokenFile != "" {
+		mux.HandleFunc("/api/v1/queues/", reloader.servePeek)
+	}
+	if *enableFailedAPI {
+		mux.Handle("/api/v1/failed", withAuthToken(http.HandlerFunc(reloader.serveFailedJobs)))
+	}
+	mux.HandleFunc("/debug/flags", debugFlags)
+	mux.HandleFunc("/debug/config", reloader.debugConfig)
+	mux.HandleFunc("/-/healthy", healthy)
+	mux.HandleFunc("/-/ready", reloader.ready)
+	mux.Handle(*metricPath, withAuthToken(metricsHandler(reloader)))
+	mux.Handle("/probe", withAuthToken(http.HandlerFunc(reloader.serveProbe)))
+	mux.HandleFunc("/sd", reloader.serveSD)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>
+<head><title>Resque Exporter</title></head>
+<body>
+<h1>Resque Exporter</h1>
+<p><a href='` + prefixPath(*metricPath) + `'>Metrics</a></p>
+</body>
+</html>
+`))
+	})
+
+	server, err := newServer(*listenAddress, withRoutePrefix(mux))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The scrapes of the requests are canceled when the server is closed.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context {
+		return baseCtx
+	}
+
+	if *scrapeInterval > 0 {
+		go reloader.scrapeEvery(baseCtx, *scrapeInterval)
+	}
+	if *remoteWriteURL != "" {
+		if err := startRemoteWrite(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *statsdAddress != "" {
+		if err := startStatsd(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *graphiteAddress != "" {
+		if err := startGraphite(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *otlpEndpoint != "" {
+		if err := startOTLP(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *influxDBURL != "" {
+		if err := startInfluxDB(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *cloudWatchNamespace != "" {
+		if err := startCloudWatch(baseCtx, reloader); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var consul *consulRegistration
+	if *consulAddress != "" {
+		if consul, err = newConsulRegistration(server); err != nil {
+			log.Fatal(err)
+		}
+		// The exporter keeps running without Consul, as it can still
+		// be scraped by the Prometheus servers configured statically.
+		if err := consul.register(baseCtx); err != nil {
+			log.Errorf("Failed to register with Consul: %s", err)
+		}
+	}
+
+	// On termination or a quit request, the in-flight scrapes are finished
+	// before closing the connections to Redis, so that they don't end up
+	// with resque_up 0. The scrapes still in flight after the shutdown
+	// timeout are canceled.
+	shutdown := make(chan struct{})
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case sig := <-term:
+			log.Infof("Received %s, shutting down", sig)
+		case <-quit:
+			log.Info("Received a quit request, shutting down")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		// The service is deregistered first, so that no more scrapes
+		// are sent to the exporter shutting down.
+		if consul != nil {
+			if err := consul.deregister(ctx); err != nil {
+				log.Errorf("Failed to deregister from Consul: %s", err)
+			}
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			log.Errorf("Failed to shut down gracefully: %s", err)
+		}
+		cancelRequests()
+		close(shutdown)
+	}()
+
+	if err := listenAndServe(server); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-shutdown
+	reloader.close()
+}
+
+// resolveTargets returns the targets to collect metrics from, given by the
+// configuration if any, or by the flags.
+func resolveTargets(c *config, explicit map[string]bool) ([]targetConfig, error) {
+	var targets []targetConfig
+	if c != nil {
+		targets = append(targets, c.Targets...)
+	}
+
+	u, _, err := lookupEnv("REDIS_URL")
+	if err != nil {
+		return nil, err
+	}
+	if len(u) > 0 {
+		targets = []targetConfig{{URL: u}}
+	} else if explicit["redis.url"] || len(targets) == 0 {
+		targets = nil
+		for _, u := range redisURLs.values {
+			targets = append(targets, targetConfig{URL: u})
+		}
+	}
+	for i := range targets {
+		if targets[i].Namespace == "" {
+			targets[i].Namespace = *redisNamespace
+		}
+	}
+
+	if len(redisFallbackURLs.values) > 0 && len(targets) > 1 {
+		return nil, errors.New("--redis.fallback-url can't be used with multiple Redis URLs")
+	}
+
+	if *redisReplicaURL != "" {
+		if len(targets) > 1 {
+			return nil, errors.New("--redis.replica-url can't be used with multiple Redis URLs")
+		}
+		// Scrapes only read from the Redis, so a replica can take the
+		// load of the scrapes off the primary.
+		targets[0].URL = *redisReplicaURL
+	}
+
+	return targets, nil
+}
+
+// newTargetsCollector returns the collector of the metrics of the targets, and
+// the exporters of each target.
+func newTargetsCollector(targets []targetConfig) (contextCollector, []*Collector, error) {
+	if len(targets) == 1 && len(targets[0].Labels) == 0 {
+		exporter, err := NewCollector(WithRedisURL(targets[0].URL), WithRedisNamespace(targets[0].Namespace))
+		if err != nil {
+			return nil, nil, err
+		}
+		return exporter, []*Collector{exporter}, nil
+	}
+
+	exporter, err := newMultiExporter(targets)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exporter, exporter.exporters, nil
+}
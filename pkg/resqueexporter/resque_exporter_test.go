@@ -0,0 +1,173 @@
+package resqueexporter
+
+import (
+	"testing"
+)
+
+func TestCollectorCoreCollectors(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_up", nil, 1)
+	assertSample(t, mfs, "resque_redis_up", nil, 1)
+	assertSample(t, mfs, "resque_job_executions_total", nil, 10)
+	assertSample(t, mfs, "resque_failed_job_executions_total", nil, 2)
+	assertSample(t, mfs, "resque_queues", nil, 2)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"}, 0)
+	assertSample(t, mfs, "resque_jobs_pending_total", nil, 3)
+	assertSample(t, mfs, "resque_failed_queues", nil, 1)
+	assertSample(t, mfs, "resque_jobs_in_failed_queue", map[string]string{"queue": "failed"}, 2)
+	assertSample(t, mfs, "resque_workers", nil, 2)
+	assertSample(t, mfs, "resque_working_workers", nil, 1)
+	for _, collector := range []string{"stats", "queues", "failed-queues", "workers"} {
+		assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": collector}, 1)
+	}
+}
+
+func TestCollectorMultipleFailedQueues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:failed_queues", "default_failed", "mailers_failed")
+	r.rpush("resque:default_failed", "{}")
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_failed_queues", nil, 2)
+	assertSample(t, mfs, "resque_jobs_in_failed_queue", map[string]string{"queue": "default_failed"}, 1)
+	assertSample(t, mfs, "resque_jobs_in_failed_queue", map[string]string{"queue": "mailers_failed"}, 0)
+}
+
+func TestCollectorNamespaces(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("other:stat:processed", "1")
+	r.set("other:stat:failed", "0")
+	r.sadd("other:queues", "default")
+	r.rpush("other:queue:default", "{}")
+
+	mfs := gather(t, newTestCollector(t, r, WithRedisNamespace("resque,other")))
+
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"namespace": "resque", "queue": "default"}, 3)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"namespace": "other", "queue": "default"}, 1)
+}
+
+func TestCollectorQueueFilter(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:queues", "default_test")
+
+	mfs := gather(t, newTestCollector(t, r, WithQueueFilter("^(default|mailers)", "_test$")))
+
+	assertSample(t, mfs, "resque_queues", nil, 2)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"}, 0)
+	assertNoSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default_test"})
+	// The failed queue doesn't match the filter.
+	assertSample(t, mfs, "resque_failed_queues", nil, 0)
+}
+
+func TestCollectorStaticQueues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	setFlags(t, map[string]string{"queue.static-list": "critical, default"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_queues", nil, 2)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "critical"}, 0)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+}
+
+func TestCollectorSkipsWrongTypeQueues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("resque:queue:mailers", "not a list")
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_up", nil, 1)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertNoSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "mailers"})
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "wrong_type"}, 1)
+}
+
+func TestCollectorRedisDown(t *testing.T) {
+	r := newFakeRedis(t)
+	c := newTestCollector(t, r)
+	r.ln.Close()
+
+	mfs := gather(t, c)
+
+	assertSample(t, mfs, "resque_up", nil, 0)
+	assertSample(t, mfs, "resque_redis_up", nil, 0)
+	assertSample(t, mfs, "resque_failed_scrapes_total", nil, 1)
+}
+
+func TestCollectorSanitizesLabelValues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:queues", "bad\xff")
+	r.rpush("resque:queue:bad\xff", "{}")
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": "default"}, 3)
+	assertSample(t, mfs, "resque_jobs_in_queue", map[string]string{"queue": `bad\xff`}, 1)
+	assertSample(t, mfs, "resque_exporter_sanitized_label_values_total", nil, 1)
+}
+
+func TestCollectorSkipsInvalidStats(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("resque:stat:failed", "not a number")
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "stats"}, 1)
+	assertSample(t, mfs, "resque_job_executions_total", nil, 10)
+	assertNoSample(t, mfs, "resque_failed_job_executions_total", nil)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "invalid_value"}, 1)
+}
+
+func TestCollectorNodeDelayedJobs(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.zadd("resque:delayed_queue_schedule", 1000, "1000")
+	r.rpush("resque:delayed:1000", "{}", "{}")
+
+	// The collector is disabled by default, even with the compatibility
+	// with node-resque.
+	setFlags(t, map[string]string{"resque.compat": "node"})
+	mfs := gather(t, newTestCollector(t, r))
+	assertNoSample(t, mfs, "resque_delayed_jobs", nil)
+
+	setFlags(t, map[string]string{"collector.node-delayed-jobs": "true"})
+	mfs = gather(t, newTestCollector(t, r))
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "node-delayed-jobs"}, 1)
+	assertSample(t, mfs, "resque_delayed_jobs", nil, 2)
+
+	// The delayed jobs of the timestamps that are not lists are skipped.
+	r.zadd("resque:delayed_queue_schedule", 2000, "2000")
+	r.set("resque:delayed:2000", "not a list")
+	mfs = gather(t, newTestCollector(t, r))
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "node-delayed-jobs"}, 1)
+	assertSample(t, mfs, "resque_delayed_jobs", nil, 2)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "wrong_type"}, 1)
+}
+
+func TestCollectorPHPMissingStats(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.del("resque:stat:processed")
+	r.del("resque:stat:failed")
+	setFlags(t, map[string]string{"resque.compat": "php"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "stats"}, 1)
+	assertSample(t, mfs, "resque_job_executions_total", nil, 0)
+	assertSample(t, mfs, "resque_failed_job_executions_total", nil, 0)
+}
@@ -0,0 +1,99 @@
+package resqueexporter
+
+import (
+	"strconv"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobClassDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_class_duration_seconds"),
+		"Duration of the executions of a job class recorded by resque-metrics.",
+		[]string{"class"}, nil,
+	)
+	jobDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "job_duration_seconds"),
+		"Duration of the executions of jobs in a queue recorded by resque-metrics.",
+		[]string{"queue"}, nil,
+	)
+)
+
+func init() {
+	registerCollector("resque-metrics", false, "Collect job durations recorded by resque-metrics.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeResqueMetrics(ch)
+	})
+}
+
+func (e *Collector) scrapeResqueMetrics(ch chan<- prometheus.Metric) error {
+	if err := e.scrapeResqueMetricsDurations(ch, "queue", jobDurationDesc); err != nil {
+		return err
+	}
+	return e.scrapeResqueMetricsDurations(ch, "job", jobClassDurationDesc)
+}
+
+// scrapeResqueMetricsDurations exports the job_count and job_time totals
+// resque-metrics records per queue or per job class. job_time is recorded
+// in milliseconds.
+func (e *Collector) scrapeResqueMetricsDurations(ch chan<- prometheus.Metric, kind string, desc *prometheus.Desc) error {
+	pattern := e.redisKeyPattern("_metrics_", "job_count", kind, "*")
+
+	var names []string
+	err := e.scanKeys(pattern.String(), func(key string) error {
+		if name, ok := pattern.Match(key); ok {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts := make([]*redis.StringCmd, len(names))
+	totals := make([]*redis.StringCmd, len(names))
+	err = e.pipelined(len(names), func(pipe redis.Pipeliner, i int) {
+		counts[i] = pipe.Get(e.redisKey("_metrics_", "job_count", kind, names[i]))
+		totals[i] = pipe.Get(e.redisKey("_metrics_", "job_time", kind, names[i]))
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, name := range names {
+		countKey := e.redisKey("_metrics_", "job_count", kind, name)
+		value, err := counts[i].Result()
+		if err == redis.Nil {
+			// The key is deleted since it is scanned.
+			continue
+		} else if isWrongTypeError(err) {
+			e.skipKey(countKey, skipWrongType, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		count, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			e.skipKey(countKey, skipInvalidValue, err)
+			continue
+		}
+
+		var total float64
+		totalKey := e.redisKey("_metrics_", "job_time", kind, name)
+		value, err = totals[i].Result()
+		if isWrongTypeError(err) {
+			e.skipKey(totalKey, skipWrongType, err)
+			continue
+		} else if err != nil && err != redis.Nil {
+			return err
+		} else if err == nil {
+			if total, err = strconv.ParseFloat(value, 64); err != nil {
+				e.skipKey(totalKey, skipInvalidValue, err)
+				continue
+			}
+		}
+		ch <- prometheus.MustNewConstSummary(desc, count, total/1000, nil, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package resqueexporter
+
+import (
+	"testing"
+)
+
+func TestCollectorResqueMetricsSkipsInvalidValues(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.set("resque:_metrics_:job_count:job:A", "4")
+	r.set("resque:_metrics_:job_time:job:A", "2000")
+	r.set("resque:_metrics_:job_count:job:B", "garbage")
+	r.set("resque:_metrics_:job_time:job:B", "1000")
+	r.set("resque:_metrics_:job_count:job:C", "2")
+	r.set("resque:_metrics_:job_time:job:C", "garbage")
+	r.set("resque:_metrics_:job_count:queue:default", "3")
+	setFlags(t, map[string]string{"collector.resque-metrics": "true"})
+
+	mfs := gather(t, newTestCollector(t, r))
+
+	assertSample(t, mfs, "resque_scrape_collector_success", map[string]string{"collector": "resque-metrics"}, 1)
+	assertSample(t, mfs, "resque_job_class_duration_seconds", map[string]string{"class": "A"}, 4)
+	assertSummarySum(t, mfs, "resque_job_class_duration_seconds", map[string]string{"class": "A"}, 2)
+	assertNoSample(t, mfs, "resque_job_class_duration_seconds", map[string]string{"class": "B"})
+	assertNoSample(t, mfs, "resque_job_class_duration_seconds", map[string]string{"class": "C"})
+	// The total time is optional.
+	assertSample(t, mfs, "resque_job_duration_seconds", map[string]string{"queue": "default"}, 3)
+	assertSummarySum(t, mfs, "resque_job_duration_seconds", map[string]string{"queue": "default"}, 0)
+	assertSample(t, mfs, "resque_scrape_skipped_keys_total", map[string]string{"reason": "invalid_value"}, 2)
+}
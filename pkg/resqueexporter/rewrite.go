@@ -0,0 +1,91 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rewriteConfig describes a rule rewriting the names of the queues matching
+// the regular expression in the labels of the metrics, e.g. to collapse the
+// names embedding IDs.
+type rewriteConfig struct {
+	Match       string `yaml:"match"`
+	Replacement string `yaml:"replacement"`
+}
+
+type rewriteRule struct {
+	config rewriteConfig
+	regexp *regexp.Regexp
+}
+
+// queueRewriteRules are the rules given by the configuration file.
+var queueRewriteRules []*rewriteRule
+
+// newRewriteRules returns the rules of the configurations. The regular
+// expressions are anchored at both ends.
+func newRewriteRules(configs []rewriteConfig) ([]*rewriteRule, error) {
+	rules := make([]*rewriteRule, 0, len(configs))
+	for i, c := range configs {
+		re, err := regexp.Compile("^(?:" + c.Match + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite rule %d: %s", i, err)
+		}
+		rules = append(rules, &rewriteRule{config: c, regexp: re})
+	}
+	return rules, nil
+}
+
+// rewriteQueue returns the name of the queue rewritten by the first rule
+// matching it, or the name as is if no rules match.
+func rewriteQueue(rules []*rewriteRule, queue string) string {
+	for _, rule := range rules {
+		if match := rule.regexp.FindStringSubmatchIndex(queue); match != nil {
+			return string(rule.regexp.ExpandString(nil, rule.config.Replacement, queue, match))
+		}
+	}
+	return queue
+}
+
+// rewriteLabels returns a channel forwarding the metrics sent to it to ch,
+// with the queue labels rewritten by the rules. The series of a metric whose
+// labels are rewritten to the same are summed. The metrics having the queue
+// labels are forwarded once all the metrics are sent. The returned function
+// must be called once all the metrics are sent, and returns after they are
+// forwarded.
+func rewriteLabels(ch chan<- prometheus.Metric, rules []*rewriteRule) (chan<- prometheus.Metric, func()) {
+	rewrittenCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		var metrics []*summedMetric
+		summed := make(map[string]*summedMetric)
+		for m := range rewrittenCh {
+			s := newLabeledSeries(m, map[string]bool{"queue": true})
+			if s == nil {
+				ch <- m
+				continue
+			}
+
+			queue := rewriteQueue(rules, s.value())
+			key := m.Desc().String() + "\xff" + s.otherKey() + "\xff" + queue
+			sum, ok := summed[key]
+			if !ok {
+				sum = newSummedMetric(s, queue)
+				summed[key] = sum
+				metrics = append(metrics, sum)
+			}
+			sum.add(s)
+		}
+
+		for _, m := range metrics {
+			ch <- m
+		}
+		close(done)
+	}()
+
+	return rewrittenCh, func() {
+		close(rewrittenCh)
+		<-done
+	}
+}
@@ -0,0 +1,105 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sanitizeLabelValue returns the value with the bytes that are not valid
+// UTF-8 and the control characters escaped like \x0a, and whether any are
+// escaped. Prometheus fails the whole scrape on a label value that is not
+// valid UTF-8, and names like queues come from Redis as raw bytes. The
+// backslashes are escaped too, so that an escaped value doesn't collide with
+// a name spelling the escape, e.g. a\xff.
+func sanitizeLabelValue(value string) (string, bool) {
+	if utf8.ValidString(value) && strings.IndexFunc(value, unicode.IsControl) < 0 && !strings.Contains(value, `\`) {
+		return value, false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, `\x%02x`, value[i])
+		case unicode.IsControl(r) && r < utf8.RuneSelf:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(value[i : i+size])
+		}
+		i += size
+	}
+	return b.String(), true
+}
+
+// sanitizedMetric is a metric whose label values are sanitized in place, so
+// that its series keep the label dimensions of the other series of the
+// family. Like labeledMetric, it must not be gathered by a pedantic registry.
+type sanitizedMetric struct {
+	prometheus.Metric
+}
+
+// Write implements prometheus.Metric.
+func (m sanitizedMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	for _, l := range out.Label {
+		if value, ok := sanitizeLabelValue(l.GetValue()); ok {
+			l.Value = proto.String(value)
+		}
+	}
+	return nil
+}
+
+// sanitizeLabels returns a channel forwarding the metrics sent to it to ch,
+// with the label values that can't be exposed sanitized. The returned function
+// must be called once all the metrics are sent, and returns the number of the
+// label values sanitized after they are forwarded.
+func sanitizeLabels(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func() int) {
+	sanitizedCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var sanitized int
+	go func() {
+		for m := range sanitizedCh {
+			if n := unsanitizedLabelValues(m); n > 0 {
+				sanitized += n
+				m = sanitizedMetric{m}
+			}
+			ch <- m
+		}
+		close(done)
+	}()
+
+	return sanitizedCh, func() int {
+		close(sanitizedCh)
+		<-done
+		return sanitized
+	}
+}
+
+// unsanitizedLabelValues returns the number of the label values of the metric
+// that need sanitizing.
+func unsanitizedLabelValues(m prometheus.Metric) int {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		return 0
+	}
+	var n int
+	for _, l := range out.Label {
+		if _, ok := sanitizeLabelValue(l.GetValue()); ok {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package resqueexporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// sdTargetGroup is a target group of the HTTP service discovery of
+// Prometheus.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// serveSD serves the targets as the target groups of the HTTP service
+// discovery of Prometheus, each of which is scraped from /probe on the host
+// the request was sent to.
+func (r *reloader) serveSD(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	groups := make([]sdTargetGroup, 0, len(r.targets))
+	for _, target := range r.targets {
+		labels := map[string]string{
+			"__metrics_path__": prefixPath("/probe"),
+			"__param_target":   redactedURL(target.URL).String(),
+			"target":           redactedURL(target.URL).String(),
+		}
+		if req.TLS != nil {
+			labels["__scheme__"] = "https"
+		}
+		for name, value := range target.Labels {
+			labels[name] = value
+		}
+		groups = append(groups, sdTargetGroup{Targets: []string{req.Host}, Labels: labels})
+	}
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(groups); err != nil {
+		log.Errorf("Failed to write the targets: %s", err)
+	}
+}
+
+// serveProbe serves the metrics of the target given by the target query
+// parameter, which is the URL of a target without its credentials. Unlike
+// the telemetry path, the metrics are not labeled with the target, and the
+// Redis is scraped on every request.
+func (r *reloader) serveProbe(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("target")
+	if name == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := scrapeContext(req)
+	defer cancel()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i, target := range r.targets {
+		if redactedURL(target.URL).String() != name {
+			continue
+		}
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(probeCollector{r.exporters[i], target.Labels, ctx}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mfs, err := registry.Gather()
+		if err != nil {
+			http.Error(w, "An error has occurred during metrics collection:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		serveMetricFamilies(w, req, mfs)
+		return
+	}
+	http.Error(w, "Unknown target: "+name, http.StatusNotFound)
+}
+
+// probeCollector is a prometheus.Collector collecting the metrics of an
+// exporter with the context, labeled with the labels of its target.
+type probeCollector struct {
+	exporter *Collector
+	labels   prometheus.Labels
+	ctx      context.Context
+}
+
+// Describe implements prometheus.Collector.
+func (c probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c probeCollector) Collect(ch chan<- prometheus.Metric) {
+	labeledCh, done := withLabels(ch, c.labels)
+	c.exporter.collect(c.ctx, labeledCh)
+	done()
+}
@@ -0,0 +1,93 @@
+package resqueexporter
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	redisSecretCheckInterval = Flags.Duration(
+		"redis.secret-check-interval",
+		30*time.Second,
+		"Interval to check the password and TLS files of Redis for changes at. The Redis clients are rebuilt when they change, so that rotated credentials are picked up without restarting. 0 disables the checks.",
+	)
+)
+
+// fileStamp tells the versions of a file apart by its modification time and
+// size. The zero stamp is of a file that can't be stat'ed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// secretFiles returns the files the Redis clients read the credentials from.
+func secretFiles() []string {
+	var files []string
+	for _, file := range []string{*redisPasswordFile, *redisTLSCAFile, *redisTLSCertFile, *redisTLSKeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// statFiles returns the stamps of the files. The symbolic links are followed,
+// so that the secrets of Kubernetes, which are updated by swapping a link to
+// a directory, are stamped by the files they point to.
+func statFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		var stamp fileStamp
+		if fi, err := os.Stat(file); err == nil {
+			stamp = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+		stamps[file] = stamp
+	}
+	return stamps
+}
+
+// changedFiles returns the files whose stamps differ, in order.
+func changedFiles(old, new map[string]fileStamp) []string {
+	var changed []string
+	for file, stamp := range new {
+		if o, ok := old[file]; !ok || !o.modTime.Equal(stamp.modTime) || o.size != stamp.size {
+			changed = append(changed, file)
+		}
+	}
+	for file := range old {
+		if _, ok := new[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watchSecretFiles checks the files the Redis clients read the credentials
+// from at the interval, and reloads the configuration to rebuild the clients
+// when any of them changes. A reload failing, e.g. as a certificate has been
+// replaced but its key not yet, is retried at the next check.
+func (r *reloader) watchSecretFiles(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	stamps := statFiles(secretFiles())
+	for range ticker.C {
+		current := statFiles(secretFiles())
+		changed := changedFiles(stamps, current)
+		if len(changed) == 0 {
+			continue
+		}
+
+		log.Infof("Rebuilding the Redis clients as %s changed", strings.Join(changed, ", "))
+		if err := r.reload(); err != nil {
+			log.Errorf("Failed to rebuild the Redis clients: %s", err)
+			continue
+		}
+		stamps = current
+	}
+}
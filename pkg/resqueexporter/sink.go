@@ -0,0 +1,147 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// sink is a destination the metrics of the targets are pushed to.
+type sink interface {
+	// push pushes the metric families gathered from the targets. The
+	// context is done when the push takes longer than the interval.
+	push(ctx context.Context, mfs []*dto.MetricFamily) error
+	// String returns the name of the destination for the logs.
+	String() string
+}
+
+// pushEvery pushes the metrics of the targets to the sink at the interval
+// until the context is done. Each scrape and push is canceled if it takes
+// longer than the interval.
+func (r *reloader) pushEvery(ctx context.Context, s sink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.pushTo(ctx, s, interval); err != nil {
+			log.Errorf("Failed to push the metrics to %s: %s", s, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *reloader) pushTo(ctx context.Context, s sink, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	gatherer, err := r.gatherer(ctx)
+	if err != nil {
+		return err
+	}
+	mfs, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.push(ctx, mfs)
+}
+
+type labelPair struct {
+	name, value string
+}
+
+// sample is a sample of a series of the metrics pushed to a sink.
+type sample struct {
+	name   string
+	labels []labelPair
+	value  float64
+	// timestamp is the time of the sample in milliseconds since the epoch.
+	timestamp int64
+	// counter is whether the value is cumulative.
+	counter bool
+}
+
+// samples returns the samples of the metric families, timestamped with the
+// given time unless the metrics have their own timestamps. The histograms and
+// the summaries are split into the series of their buckets, quantiles, sums
+// and counts.
+func samples(mfs []*dto.MetricFamily, now time.Time) []sample {
+	var samples []sample
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			timestamp := now.UnixNano() / int64(time.Millisecond)
+			if m.TimestampMs != nil {
+				timestamp = m.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, counter bool, extra ...labelPair) {
+				labels := make([]labelPair, 0, len(m.Label)+len(extra))
+				for _, l := range m.Label {
+					labels = append(labels, labelPair{l.GetName(), l.GetValue()})
+				}
+				labels = append(labels, extra...)
+				samples = append(samples, sample{
+					name:      mf.GetName() + suffix,
+					labels:    sortLabels(labels),
+					value:     value,
+					timestamp: timestamp,
+					counter:   counter,
+				})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue(), true)
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue(), false)
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue(), false)
+			case dto.MetricType_SUMMARY:
+				for _, q := range m.GetSummary().Quantile {
+					add("", q.GetValue(), false, labelPair{model.QuantileLabel, fmt.Sprint(q.GetQuantile())})
+				}
+				add("_sum", m.GetSummary().GetSampleSum(), true)
+				add("_count", float64(m.GetSummary().GetSampleCount()), true)
+			case dto.MetricType_HISTOGRAM:
+				buckets := m.GetHistogram().Bucket
+				for _, b := range buckets {
+					add("_bucket", float64(b.GetCumulativeCount()), true, labelPair{model.BucketLabel, fmt.Sprint(b.GetUpperBound())})
+				}
+				if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+					add("_bucket", float64(m.GetHistogram().GetSampleCount()), true, labelPair{model.BucketLabel, "+Inf"})
+				}
+				add("_sum", m.GetHistogram().GetSampleSum(), true)
+				add("_count", float64(m.GetHistogram().GetSampleCount()), true)
+			}
+		}
+	}
+	return samples
+}
+
+// sortLabels sorts the labels by name, keeping the first of the labels of the
+// same name.
+func sortLabels(labels []labelPair) []labelPair {
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].name < labels[j].name
+	})
+	sorted := labels[:0]
+	for i, l := range labels {
+		if i == 0 || l.name != labels[i-1].name {
+			sorted = append(sorted, l)
+		}
+	}
+	return sorted
+}
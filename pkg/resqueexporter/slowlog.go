@@ -0,0 +1,209 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	scrapeSlowLogThreshold = Flags.Duration(
+		"scrape.slow-log-threshold",
+		0,
+		"Log the scrapes taking longer than the threshold with the time spent in each phase and Redis command. 0 disables the log.",
+	)
+)
+
+// maxSlowLogCommands is the number of the most time-consuming Redis commands
+// logged for a slow scrape.
+const maxSlowLogCommands = 5
+
+// scrapeTrace records the time spent in each phase of a scrape and in each
+// Redis command, and the number of the commands sent in each phase. The
+// methods do nothing on a nil trace.
+type scrapeTrace struct {
+	mu            sync.Mutex
+	phase         string
+	phaseStart    time.Time
+	phases        []string
+	phaseTimes    map[string]time.Duration
+	phaseCommands map[string]int
+	commands      map[string]*commandTiming
+}
+
+type commandTiming struct {
+	name  string
+	count int
+	time  time.Duration
+}
+
+func newScrapeTrace() *scrapeTrace {
+	return &scrapeTrace{
+		phaseTimes:    make(map[string]time.Duration),
+		phaseCommands: make(map[string]int),
+		commands:      make(map[string]*commandTiming),
+	}
+}
+
+// begin ends the current phase and begins the given one.
+func (t *scrapeTrace) begin(phase string) {
+	if t == nil {
+		return
+	}
+	t.end()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phase, t.phaseStart = phase, time.Now()
+	if _, ok := t.phaseTimes[phase]; !ok {
+		t.phases = append(t.phases, phase)
+		t.phaseTimes[phase] = 0
+	}
+}
+
+// end ends the current phase.
+func (t *scrapeTrace) end() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.phase != "" {
+		t.phaseTimes[t.phase] += time.Since(t.phaseStart)
+		t.phase = ""
+	}
+}
+
+// command records the time spent in a Redis command.
+func (t *scrapeTrace) command(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.commands[name]
+	if !ok {
+		c = &commandTiming{name: name}
+		t.commands[name] = c
+	}
+	c.count++
+	c.time += d
+	if t.phase != "" {
+		t.phaseCommands[t.phase]++
+	}
+}
+
+// fields returns the timings as log fields, i.e. the time spent in each
+// phase, and the number of and the time spent in the most time-consuming
+// commands.
+func (t *scrapeTrace) fields() log.Fields {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make([]string, 0, len(t.phases))
+	for _, phase := range t.phases {
+		phases = append(phases, fmt.Sprintf("%s=%s", phase, t.phaseTimes[phase]))
+	}
+
+	commands := make([]*commandTiming, 0, len(t.commands))
+	for _, c := range t.commands {
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].time > commands[j].time
+	})
+	if len(commands) > maxSlowLogCommands {
+		commands = commands[:maxSlowLogCommands]
+	}
+	top := make([]string, 0, len(commands))
+	for _, c := range commands {
+		top = append(top, fmt.Sprintf("%s=%dx%s", c.name, c.count, c.time))
+	}
+
+	return log.Fields{
+		"phases":   strings.Join(phases, " "),
+		"commands": strings.Join(top, " "),
+	}
+}
+
+// traceClient returns a copy of the client recording the time spent in each
+// command to the trace. A pipeline is recorded as a single command named after
+// the commands in it.
+func traceClient(client redis.UniversalClient, t *scrapeTrace) redis.UniversalClient {
+	wrapProcess := func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			t.command(cmd.Name(), time.Since(start))
+			return err
+		}
+	}
+	wrapProcessPipeline := func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			t.command(pipelineName(cmds), time.Since(start))
+			return err
+		}
+	}
+
+	switch c := client.(type) {
+	case *redis.Client:
+		c = c.WithContext(context.Background())
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+		return c
+	case *redis.ClusterClient:
+		c = c.WithContext(context.Background())
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+		return c
+	}
+	return client
+}
+
+// pipelineName returns the name of the pipeline of the commands, e.g.
+// pipeline[exists,llen].
+func pipelineName(cmds []redis.Cmder) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, cmd := range cmds {
+		if name := cmd.Name(); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return "pipeline[" + strings.Join(names, ",") + "]"
+}
+
+// scrapeLogged scrapes with the client, logging the scrape if it takes longer
+// than the threshold given by --scrape.slow-log-threshold.
+func (e *Collector) scrapeLogged(client redis.UniversalClient, ch chan<- prometheus.Metric) error {
+	if *scrapeSlowLogThreshold <= 0 {
+		return e.withClient(client).scrape(ch)
+	}
+
+	t := newScrapeTrace()
+	traced := e.withClient(traceClient(client, t))
+	traced.trace = t
+
+	start := time.Now()
+	err := traced.scrape(ch)
+	if elapsed := time.Since(start); elapsed > *scrapeSlowLogThreshold {
+		e.logger.WithFields(t.fields()).Warnf("Scrape took %s", elapsed)
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// srvDialer returns a dialer connecting to the targets of the DNS SRV record
+// of the name. The record is resolved on every dial, so that a Redis moved to
+// another host is reached once the connection to the previous one fails.
+func srvDialer(name string, timeout time.Duration) func() (net.Conn, error) {
+	return func() (net.Conn, error) {
+		_, addrs, err := net.LookupSRV("", "", name)
+		if err != nil {
+			return nil, err
+		}
+
+		// The records are sorted by priority, and randomized by weight
+		// within the same priority.
+		err = fmt.Errorf("no SRV records for %s", name)
+		for _, addr := range addrs {
+			var conn net.Conn
+			address := net.JoinHostPort(addr.Target, strconv.Itoa(int(addr.Port)))
+			if conn, err = net.DialTimeout("tcp", address, timeout); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,109 @@
+package resqueexporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Stats are the results of a scrape of Resque. With multiple namespaces, the
+// values of all the namespaces are summed.
+type Stats struct {
+	// Processed and Failed are the numbers of processed and failed jobs.
+	Processed float64
+	Failed    float64
+
+	// Queues and FailedQueues are the numbers of jobs in each queue and
+	// failed queue matching the queue filter, by their names in Redis.
+	// Unlike the labels of the metrics, the names are not rewritten,
+	// limited or sanitized.
+	Queues       map[string]int64
+	FailedQueues map[string]int64
+
+	// Workers and WorkingWorkers are the numbers of workers and of the
+	// ones working a job.
+	Workers        int64
+	WorkingWorkers int64
+
+	// Durations are the time each collector of the scrape took.
+	Durations map[string]time.Duration
+
+	// Duration is the time the scrape took.
+	Duration time.Duration
+}
+
+// Scrape scrapes Redis with the context, and returns the results without
+// exporting them as metrics. The results collected before an error are
+// returned along with it.
+func (e *Collector) Scrape(ctx context.Context) (*Stats, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	stats := &Stats{
+		Queues:       make(map[string]int64),
+		FailedQueues: make(map[string]int64),
+		Durations:    make(map[string]time.Duration),
+	}
+
+	redisClient, _ := e.redisEndpoints.get()
+	ch := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		errCh <- e.withRawLabels().scrapeContext(ctx, redisClient, ch)
+		close(ch)
+	}()
+	for m := range ch {
+		stats.add(m)
+	}
+	stats.Duration = time.Since(start)
+
+	return stats, <-errCh
+}
+
+// add adds the value of the metric to the stats if it is one of them.
+func (s *Stats) add(m prometheus.Metric) {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		return
+	}
+	var value float64
+	switch {
+	case out.Gauge != nil:
+		value = out.Gauge.GetValue()
+	case out.Counter != nil:
+		value = out.Counter.GetValue()
+	default:
+		return
+	}
+	label := func(name string) string {
+		for _, l := range out.Label {
+			if l.GetName() == name {
+				return l.GetValue()
+			}
+		}
+		return ""
+	}
+
+	switch m.Desc() {
+	case jobExecutionsDesc:
+		s.Processed += value
+	case failedJobExecutionsDesc:
+		s.Failed += value
+	case jobsInQueueDesc:
+		s.Queues[label("queue")] += int64(value)
+	case jobsInFailedQueueDesc:
+		s.FailedQueues[label("queue")] += int64(value)
+	case workersDesc:
+		s.Workers += int64(value)
+	case workingWorkersDesc:
+		s.WorkingWorkers += int64(value)
+	case scrapeCollectorDurationDesc:
+		s.Durations[label("collector")] += time.Duration(value * float64(time.Second))
+	}
+}
@@ -0,0 +1,45 @@
+package resqueexporter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCollectorScrapeRawQueueNames(t *testing.T) {
+	r := newFakeRedis(t)
+	seedResque(r)
+	r.sadd("resque:queues", "mailer_shard_1", "mailer_shard_2", "bad\xff")
+	r.rpush("resque:queue:mailer_shard_1", "{}")
+	r.rpush("resque:queue:mailer_shard_2", "{}", "{}")
+	r.rpush("resque:queue:bad\xff", "{}")
+	setFlags(t, map[string]string{"scrape.label-limit": "2"})
+	rules, err := newRewriteRules([]rewriteConfig{{Match: `mailer_shard_\d+`, Replacement: "mailer_shard"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := queueRewriteRules
+	queueRewriteRules = rules
+	t.Cleanup(func() { queueRewriteRules = saved })
+
+	stats, err := newTestCollector(t, r).Scrape(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stats are of the queues in Redis, not of the labels of the
+	// metrics.
+	for queue, want := range map[string]int64{
+		"default":        3,
+		"mailers":        0,
+		"mailer_shard_1": 1,
+		"mailer_shard_2": 2,
+		"bad\xff":        1,
+	} {
+		if got, ok := stats.Queues[queue]; !ok || got != want {
+			t.Errorf("queue %q: got %d, want %d", queue, got, want)
+		}
+	}
+	if len(stats.Queues) != 5 {
+		t.Errorf("got %d queues, want 5: %v", len(stats.Queues), stats.Queues)
+	}
+}
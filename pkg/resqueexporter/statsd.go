@@ -0,0 +1,159 @@
+package resqueexporter
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	statsdAddress = Flags.String(
+		"statsd.address",
+		"",
+		"Address of the StatsD server to send the metrics to over UDP at the interval, in addition to serving them over HTTP.",
+	)
+	statsdInterval = Flags.Duration(
+		"statsd.interval",
+		15*time.Second,
+		"Interval to send the metrics to the StatsD server at.",
+	)
+	statsdPrefix = Flags.String(
+		"statsd.prefix",
+		"",
+		"Prefix of the names of the metrics sent to the StatsD server.",
+	)
+	statsdTags = Flags.Bool(
+		"statsd.tags",
+		false,
+		"Send the labels as the tags of DogStatsD instead of appending their values to the names of the metrics sent to the StatsD server.",
+	)
+)
+
+// statsdMaxPacketSize is the maximum size of the UDP packets sent to the
+// StatsD server, which fits in the MTU of the Ethernet.
+const statsdMaxPacketSize = 1432
+
+// statsdSink sends the metrics to a StatsD server. The gauges are sent as the
+// gauges of StatsD, and the counters as the counters of StatsD incremented by
+// the increase of the counters since the last push.
+type statsdSink struct {
+	address string
+	conn    net.Conn
+
+	// counters is the values of the counters of the last push.
+	counters map[string]float64
+}
+
+func newStatsdSink(address string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdSink{
+		address:  address,
+		conn:     conn,
+		counters: make(map[string]float64),
+	}, nil
+}
+
+// String implements sink.
+func (s *statsdSink) String() string {
+	return "statsd://" + s.address
+}
+
+// push implements sink.
+func (s *statsdSink) push(ctx context.Context, mfs []*dto.MetricFamily) error {
+	counters := make(map[string]float64, len(s.counters))
+	var packet []byte
+	for _, sample := range samples(mfs, time.Now()) {
+		name, tags := s.name(sample)
+		line := name + ":"
+		if sample.counter {
+			key := name + "|" + tags
+			counters[key] = sample.value
+			last, ok := s.counters[key]
+			if !ok {
+				// The increase is unknown until the next push.
+				continue
+			}
+			increase := sample.value - last
+			if increase < 0 {
+				// The counter has been reset.
+				increase = sample.value
+			}
+			line += strconv.FormatFloat(increase, 'f', -1, 64) + "|c"
+		} else {
+			line += strconv.FormatFloat(sample.value, 'f', -1, 64) + "|g"
+		}
+		if tags != "" {
+			line += "|#" + tags
+		}
+
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacketSize {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	s.counters = counters
+
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// name returns the name of the sample in StatsD, and its tags if the labels
+// are sent as tags.
+func (s *statsdSink) name(sample sample) (string, string) {
+	name := sample.name
+	if *statsdPrefix != "" {
+		name = *statsdPrefix + "." + name
+	}
+
+	if *statsdTags {
+		tags := make([]string, 0, len(sample.labels))
+		for _, l := range sample.labels {
+			tags = append(tags, l.name+":"+statsdSanitize(l.value, ""))
+		}
+		return name, strings.Join(tags, ",")
+	}
+
+	for _, l := range sample.labels {
+		name += "." + statsdSanitize(l.value, ".")
+	}
+	return name, ""
+}
+
+// statsdSanitize replaces the characters having special meanings in the
+// StatsD protocol, and the given separators, with underscores.
+func statsdSanitize(s, separators string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(":|@#, \n"+separators, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// startStatsd starts sending the metrics of the targets to the StatsD server
+// given by --statsd.address until the context is done.
+func startStatsd(ctx context.Context, r *reloader) error {
+	s, err := newStatsdSink(*statsdAddress)
+	if err != nil {
+		return err
+	}
+	go r.pushEvery(ctx, s, *statsdInterval)
+	return nil
+}
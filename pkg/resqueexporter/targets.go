@@ -0,0 +1,106 @@
+package resqueexporter
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stringsValue is a flag.Value accumulating the values of a repeated flag.
+// The first value given replaces the default.
+type stringsValue struct {
+	values []string
+	set    bool
+}
+
+func newStringsValue(defaults ...string) *stringsValue {
+	return &stringsValue{values: defaults}
+}
+
+// String implements flag.Value.
+func (v *stringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(v.values, ",")
+}
+
+// Set implements flag.Value.
+func (v *stringsValue) Set(value string) error {
+	if !v.set {
+		v.values = nil
+		v.set = true
+	}
+	v.values = append(v.values, value)
+	return nil
+}
+
+// multiExporter collects metrics from the Redis of multiple Resque exporters,
+// labeling the metrics of each exporter with its target and the labels given
+// by the configuration. It implements prometheus.Collector.
+type multiExporter struct {
+	exporters []*Collector
+	labels    []prometheus.Labels
+}
+
+// newMultiExporter returns an exporter collecting metrics from each of the
+// targets. The metrics are labeled with the target only if there are more than
+// one of them.
+func newMultiExporter(targets []targetConfig) (*multiExporter, error) {
+	// All the metrics of the same name must have the same label names, so
+	// the labels missing from some of the targets are added empty.
+	names := make(map[string]bool)
+	for _, target := range targets {
+		for name := range target.Labels {
+			names[name] = true
+		}
+	}
+
+	m := &multiExporter{}
+	for _, target := range targets {
+		exporter, err := NewCollector(WithRedisURL(target.URL), WithRedisNamespace(target.Namespace))
+		if err != nil {
+			return nil, err
+		}
+
+		labels := make(prometheus.Labels)
+		for name := range names {
+			labels[name] = target.Labels[name]
+		}
+		if len(targets) > 1 {
+			labels["target"] = redactedURL(target.URL).String()
+		}
+
+		m.exporters = append(m.exporters, exporter)
+		m.labels = append(m.labels, labels)
+	}
+	return m, nil
+}
+
+// Describe implements prometheus.Collector.
+func (m *multiExporter) Describe(ch chan<- *prometheus.Desc) {
+	m.exporters[0].Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *multiExporter) Collect(ch chan<- prometheus.Metric) {
+	m.collect(context.Background(), ch)
+}
+
+// collect collects the metrics of all the exporters, canceling their scrapes
+// when the context is done.
+func (m *multiExporter) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	wg.Add(len(m.exporters))
+	for i, exporter := range m.exporters {
+		go func(exporter *Collector, labels prometheus.Labels) {
+			defer wg.Done()
+			targetCh, done := withLabels(ch, labels)
+			exporter.collect(ctx, targetCh)
+			done()
+		}(exporter, m.labels[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package resqueexporter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	textfilePath = Flags.String(
+		"textfile.path",
+		"",
+		"Path to the file to write the metrics to in the text format at the interval, e.g. for the textfile collector of node_exporter, instead of serving them over HTTP.",
+	)
+	textfileInterval = Flags.Duration(
+		"textfile.interval",
+		15*time.Second,
+		"Interval to write the metrics to the file given by --textfile.path at.",
+	)
+)
+
+// writeTextfileEvery writes the metrics to the file at the interval until the
+// context is done.
+func (r *reloader) writeTextfileEvery(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.writeTextfile(ctx, path, interval); err != nil {
+			log.Errorf("Failed to write the metrics to %s: %s", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeTextfile scrapes the targets and writes the metrics to the file. The
+// metrics are written to a temporary file in the same directory, which is
+// renamed to the file, so that the textfile collector never reads a partially
+// written file. The scrape is canceled if it takes longer than the timeout.
+func (r *reloader) writeTextfile(ctx context.Context, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The textfile collector ignores the files not ending in .prom.
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = r.writeMetrics(ctx, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
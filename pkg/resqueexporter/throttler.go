@@ -0,0 +1,112 @@
+package resqueexporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	throttlerLimits = Flags.String(
+		"throttler.limits",
+		"",
+		"Comma-separated list of <queue>=<limit> rate limits configured for resque-throttler.",
+	)
+)
+
+var (
+	queueThrottledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "queue_throttled"),
+		"Whether a queue has reached its rate limit.",
+		[]string{"queue"}, nil,
+	)
+	throttlerBucketJobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "throttler", "bucket_jobs"),
+		"Number of jobs counted against the rate limit of a queue.",
+		[]string{"queue"}, nil,
+	)
+	throttlerLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "throttler", "limit"),
+		"Number of jobs allowed within the rate limit period of a queue.",
+		[]string{"queue"}, nil,
+	)
+)
+
+func init() {
+	registerCollector("throttler", false, "Collect the rate limit buckets of queues throttled by resque-throttler.", func(e *Collector, s *scrapeState, ch chan<- prometheus.Metric) error {
+		return e.scrapeThrottler(ch)
+	})
+}
+
+func (e *Collector) scrapeThrottler(ch chan<- prometheus.Metric) error {
+	limits, err := parseThrottlerLimits(*throttlerLimits)
+	if err != nil {
+		return err
+	}
+
+	// resque-throttler tracks the jobs started within the current rate limit
+	// period of a queue in the throttler:<queue>_uuids set.
+	pattern := e.redisKeyPattern("throttler", "*_uuids")
+	buckets := make(map[string]string)
+	err = e.scanKeys(pattern.String(), func(key string) error {
+		if queue, ok := pattern.Match(key); ok {
+			buckets[queue] = key
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for queue := range limits {
+		if _, ok := buckets[queue]; !ok {
+			buckets[queue] = pattern.Key(queue)
+		}
+	}
+
+	for queue, key := range buckets {
+		jobs, err := e.redisClient.SCard(key).Result()
+		if isWrongTypeError(err) {
+			e.skipKey(key, skipWrongType, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(throttlerBucketJobsDesc, prometheus.GaugeValue, float64(jobs), queue)
+
+		limit, ok := limits[queue]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(throttlerLimitDesc, prometheus.GaugeValue, float64(limit), queue)
+
+		var throttled float64
+		if jobs >= limit {
+			throttled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(queueThrottledDesc, prometheus.GaugeValue, throttled, queue)
+	}
+
+	return nil
+}
+
+func parseThrottlerLimits(s string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	for _, limit := range strings.Split(s, ",") {
+		if limit == "" {
+			continue
+		}
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rate limit: %s", limit)
+		}
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit: %s", limit)
+		}
+		limits[parts[0]] = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,148 @@
+package resqueexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scrapeTimeoutOffset = Flags.Duration(
+		"scrape.timeout-offset",
+		500*time.Millisecond,
+		"Offset to subtract from the timeout given by scrapers in the X-Prometheus-Scrape-Timeout-Seconds header, leaving time to respond.",
+	)
+)
+
+// scrapeContext returns the context of the scrape requested by the request,
+// which is canceled if the request is canceled, or when the timeout given by
+// the X-Prometheus-Scrape-Timeout-Seconds header minus the offset given by
+// --scrape.timeout-offset is exceeded.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return context.WithCancel(r.Context())
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+
+	timeout := time.Duration(seconds*float64(time.Second)) - *scrapeTimeoutOffset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// withContext returns a copy of the exporter whose scrapes are canceled when
+// the context is done.
+func (e *Collector) withContext(ctx context.Context) *Collector {
+	c := *e
+	c.ctx = ctx
+	return &c
+}
+
+// begin begins a phase of the scrape, or returns an error if the scrape is
+// canceled.
+func (e *Collector) begin(phase string) error {
+	if err := e.canceled(); err != nil {
+		return err
+	}
+	e.trace.begin(phase)
+	return nil
+}
+
+// canceled returns an error if the scrape is canceled.
+func (e *Collector) canceled() error {
+	if e.ctx == nil || e.ctx.Err() == nil {
+		return nil
+	}
+	return fmt.Errorf("scrape canceled: %s", e.ctx.Err())
+}
+
+// scrapeContext scrapes with the client until the context is done. The
+// metrics scraped before the context is done are sent to the channel, and an
+// error is returned without waiting for the command in flight.
+func (e *Collector) scrapeContext(ctx context.Context, client redis.UniversalClient, ch chan<- prometheus.Metric) error {
+	if ctx.Done() == nil {
+		return e.scrapeLogged(client, ch)
+	}
+
+	scrapeCh := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.withContext(ctx).scrapeLogged(contextClient(ctx, client), scrapeCh)
+		close(scrapeCh)
+	}()
+
+	for {
+		select {
+		case m, ok := <-scrapeCh:
+			if !ok {
+				return <-errCh
+			}
+			// The metrics made from the results of the commands
+			// skipped after the context is done are discarded.
+			if ctx.Err() == nil {
+				ch <- m
+				continue
+			}
+		case <-ctx.Done():
+		}
+
+		go func() {
+			for range scrapeCh {
+			}
+		}()
+		return fmt.Errorf("scrape canceled: %s", ctx.Err())
+	}
+}
+
+// contextClient returns a copy of the client with the context, skipping the
+// commands once the context is done. The commands skipped return no errors
+// and have no results.
+//
+// The context is only checked between the commands, and the deadline of the
+// context is not set on the connections. The vendored go-redis keeps the
+// context of a client without using it, and sets the deadlines of the
+// connections from the read and write timeouts before every command, so a
+// command in flight when the context is done runs until it completes or
+// --redis.read-timeout expires. scrapeContext doesn't wait for it.
+func contextClient(ctx context.Context, client redis.UniversalClient) redis.UniversalClient {
+	wrapProcess := func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return process(cmd)
+		}
+	}
+	wrapProcessPipeline := func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return process(cmds)
+		}
+	}
+
+	switch c := client.(type) {
+	case *redis.Client:
+		c = c.WithContext(ctx)
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+		return c
+	case *redis.ClusterClient:
+		c = c.WithContext(ctx)
+		c.WrapProcess(wrapProcess)
+		c.WrapProcessPipeline(wrapProcessPipeline)
+		return c
+	}
+	return client
+}
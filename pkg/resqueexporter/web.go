@@ -0,0 +1,381 @@
+package resqueexporter
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	webAllowedCIDRs = Flags.String(
+		"web.allowed-cidrs",
+		"",
+		"Comma-separated list of CIDRs of the addresses allowed to access the web endpoints. Not applied to the requests over Unix domain sockets. Defaults to allowing all addresses.",
+	)
+	webAuthToken = Flags.String(
+		"web.auth-token",
+		"",
+		"Bearer token required to access the telemetry path.",
+	)
+	webAuthTokenFile = Flags.String(
+		"web.auth-token-file",
+		"",
+		"File containing the bearer token required to access the telemetry path. Re-read on every request.",
+	)
+	webConfigFile = Flags.String(
+		"web.config.file",
+		"",
+		"Path to the configuration file enabling TLS or basic authentication, in the format of the Prometheus exporter-toolkit.",
+	)
+)
+
+// webServerConfig is the configuration of the web server read from the file
+// given by --web.config.file. It follows the format of the exporter-toolkit of
+// Prometheus.
+type webServerConfig struct {
+	TLSServerConfig *tlsServerConfig  `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string     `yaml:"cert_file"`
+	KeyFile        string     `yaml:"key_file"`
+	ClientAuthType string     `yaml:"client_auth_type"`
+	ClientCAFile   string     `yaml:"client_ca_file"`
+	MinVersion     tlsVersion `yaml:"min_version"`
+	MaxVersion     tlsVersion `yaml:"max_version"`
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// tlsVersion is a TLS version given by its name, e.g. TLS12.
+type tlsVersion uint16
+
+var tlsVersions = map[string]tlsVersion{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (v *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	version, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("unknown TLS version: %s", s)
+	}
+	*v = version
+	return nil
+}
+
+// loadWebConfig reads and validates the web configuration file.
+func loadWebConfig(filename string) (*webServerConfig, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c webServerConfig
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid web config file %s: %s", filename, err)
+	}
+
+	if t := c.TLSServerConfig; t != nil {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("both cert_file and key_file are required for TLS")
+		}
+		clientAuth, ok := clientAuthTypes[t.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth_type: %s", t.ClientAuthType)
+		}
+		if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && t.ClientCAFile == "" {
+			return nil, fmt.Errorf("client_ca_file is required to verify client certificates")
+		}
+	}
+
+	return &c, nil
+}
+
+// tlsConfig returns the TLS configuration of the server, or nil if TLS is not
+// enabled.
+func (c *webServerConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSServerConfig == nil {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSServerConfig.CertFile, c.TLSServerConfig.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   uint16(c.TLSServerConfig.MinVersion),
+		MaxVersion:   uint16(c.TLSServerConfig.MaxVersion),
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	config.ClientAuth = clientAuthTypes[c.TLSServerConfig.ClientAuthType]
+	if c.TLSServerConfig.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(c.TLSServerConfig.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", c.TLSServerConfig.ClientCAFile)
+		}
+	}
+	return config, nil
+}
+
+// dummyPasswordHash is the bcrypt hash the passwords of the unknown users are
+// compared with, so that they take as long to reject as the wrong passwords of
+// the known users, and the users can't be enumerated by timing.
+const dummyPasswordHash = "$2a$10$HI5fKEW9JoaoZWNogSd7vO1PyUNVLMM/845O8mpchvoSOjdIGWO76"
+
+// withBasicAuth returns a handler requiring the users of the configuration to
+// authenticate before passing requests to the handler. The handler is
+// returned as is if there are no users.
+func (c *webServerConfig) withBasicAuth(handler http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if ok {
+			hash, found := c.BasicAuthUsers[user]
+			if !found {
+				hash = dummyPasswordHash
+			}
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil && found {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="resque_exporter"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// readToken returns the token in the file.
+func readToken(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// hasBearerToken reports whether the request bears the token in its
+// Authorization header. An empty token is never borne.
+func hasBearerToken(r *http.Request, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// withAuthToken returns a handler requiring the token given by
+// --web.auth-token or --web.auth-token-file before passing requests to the
+// handler. The handler is returned as is if no token is given.
+func withAuthToken(handler http.Handler) http.Handler {
+	if *webAuthToken == "" && *webAuthTokenFile == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := *webAuthToken
+		if *webAuthTokenFile != "" {
+			var err error
+			if token, err = readToken(*webAuthTokenFile); err != nil {
+				log.Errorf("Failed to read the auth token: %s", err)
+				http.Error(w, "Failed to read the auth token", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !hasBearerToken(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// withAllowedCIDRs returns a handler forbidding the requests from addresses
+// out of the CIDRs given by --web.allowed-cidrs before passing the requests to
+// the handler. The handler is returned as is if no CIDRs are given. The
+// requests over Unix domain sockets, whose remote addresses are not IP
+// addresses, are passed as is, as the access to the sockets is controlled by
+// their file permissions.
+func withAllowedCIDRs(handler http.Handler) (http.Handler, error) {
+	if *webAllowedCIDRs == "" {
+		return handler, nil
+	}
+
+	var allowed []*net.IPNet
+	for _, cidr := range strings.Split(*webAllowedCIDRs, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		allowed = append(allowed, ipNet)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, ipNet := range allowed {
+				if ipNet.Contains(ip) {
+					handler.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}), nil
+}
+
+// prefixPath returns the path prefixed with the prefix given by
+// --web.route-prefix.
+func prefixPath(p string) string {
+	return path.Join("/", *routePrefix, p)
+}
+
+// withRoutePrefix returns a handler passing the requests under the prefix
+// given by --web.route-prefix to the handler, with the prefix stripped from
+// their paths. The other requests are redirected to the prefix. The handler is
+// returned as is if the prefix is /.
+func withRoutePrefix(handler http.Handler) http.Handler {
+	prefix := prefixPath("/")
+	if prefix == "/" {
+		return handler
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+	mux.Handle("/", http.RedirectHandler(prefix+"/", http.StatusFound))
+	return mux
+}
+
+// newServer returns a server of the handler on the address, with TLS and basic
+// authentication if configured by the web configuration file, and only
+// allowing the addresses given by --web.allowed-cidrs.
+func newServer(addr string, handler http.Handler) (*http.Server, error) {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	if *webConfigFile != "" {
+		c, err := loadWebConfig(*webConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		if server.TLSConfig, err = c.tlsConfig(); err != nil {
+			return nil, err
+		}
+		server.Handler = c.withBasicAuth(server.Handler)
+	}
+
+	var err error
+	if server.Handler, err = withAllowedCIDRs(server.Handler); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// systemdListener returns the listener passed by systemd socket activation,
+// or nil if the exporter is not socket-activated.
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("only one socket can be passed by systemd, got %d", n)
+	}
+
+	// The variables are unset so that they are not inherited by child
+	// processes, like sd_listen_fds(3) does.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// The passed file descriptors start at 3.
+	f := os.NewFile(3, "LISTEN_FD_3")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// listen listens on the socket passed by systemd socket activation if any.
+// Otherwise it listens on the address, which is either a TCP address or the
+// path to a Unix domain socket prefixed with unix://.
+func listen(addr string) (net.Listener, error) {
+	if l, err := systemdListener(); l != nil || err != nil {
+		return l, err
+	}
+
+	if !strings.HasPrefix(addr, "unix://") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix://")
+	// A socket left by an exporter killed before removing it would make
+	// listening fail.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// listenAndServe serves on the address of the server, over TLS if the server
+// has its TLS configuration.
+func listenAndServe(server *http.Server) error {
+	l, err := listen(server.Addr)
+	if err != nil {
+		return err
+	}
+	log.Infoln("Listening on", l.Addr())
+
+	if server.TLSConfig != nil {
+		return server.ServeTLS(l, "", "")
+	}
+	return server.Serve(l)
+}
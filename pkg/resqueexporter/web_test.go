@@ -0,0 +1,86 @@
+package resqueexporter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWithBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &webServerConfig{BasicAuthUsers: map[string]string{"prometheus": string(hash)}}
+	handler := c.withBasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		user, password string
+		want           int
+	}{
+		{"prometheus", "secret", http.StatusOK},
+		{"prometheus", "wrong", http.StatusUnauthorized},
+		{"unknown", "secret", http.StatusUnauthorized},
+		// The unknown users are rejected even with the password of the
+		// dummy hash they are compared with.
+		{"unknown", "resque_exporter dummy password", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.SetBasicAuth(tc.user, tc.password)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s:%s: got status %d, want %d", tc.user, tc.password, w.Code, tc.want)
+		}
+	}
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	if _, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithAllowedCIDRs(t *testing.T) {
+	setFlags(t, map[string]string{"web.allowed-cidrs": "10.0.0.0/8"})
+	handler, err := withAllowedCIDRs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		network, addr string
+		want          int
+	}{
+		{"tcp", "127.0.0.1:0", http.StatusForbidden},
+		// The requests over Unix domain sockets are not restricted.
+		{"unix", filepath.Join(t.TempDir(), "web.sock"), http.StatusOK},
+	} {
+		l, err := net.Listen(tc.network, tc.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: handler}
+		go server.Serve(l)
+		defer server.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, tc.network, l.Addr().String())
+			},
+		}}
+		resp, err := client.Get("http://exporter/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.network, resp.StatusCode, tc.want)
+		}
+	}
+}